@@ -0,0 +1,225 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/hashicorp/go-version"
+	"golang.org/x/mod/semver"
+)
+
+// BaselinePolicy picks the released tags that an upgrade test upgrades from, among all tags of a BaselineSource.
+// It returns CannotTestError when no tag fits. More than one tag runs one subtest per tag.
+type BaselinePolicy interface {
+	Select(tags []string, currentMajorVer int) ([]string, error)
+}
+
+var _ BaselinePolicy = LatestWithinMajor{}
+var _ BaselinePolicy = PreviousMinor{}
+var _ BaselinePolicy = LatestPatches{}
+var _ BaselinePolicy = ExplicitTag("")
+var _ BaselinePolicy = SemverConstraint("")
+var _ BaselinePolicy = ReleasesMatching("")
+var _ BaselinePolicy = Baselines{}
+
+// LatestWithinMajor picks the newest release within the current major version, it's the default policy.
+// Tags containing "rc" are skipped, IncludePrerelease considers all prereleases too.
+type LatestWithinMajor struct {
+	IncludePrerelease bool
+}
+
+func (p LatestWithinMajor) Select(tags []string, currentMajorVer int) ([]string, error) {
+	if p.IncludePrerelease {
+		return newest(releasesWithinMajor(tags, currentMajorVer, true), 1)
+	}
+	latest := latestTagWithinMajorVersion(tags, currentMajorVer)
+	if latest == "" {
+		return nil, CannotTestError
+	}
+	return []string{latest}, nil
+}
+
+// PreviousMinor picks the newest release of the minor version before the latest one within the current major version,
+// eg: v1.3.2 when the latest releases are v1.4.0 and v1.4.1.
+type PreviousMinor struct{}
+
+func (p PreviousMinor) Select(tags []string, currentMajorVer int) ([]string, error) {
+	releases := releasesWithinMajor(tags, currentMajorVer, false)
+	if len(releases) == 0 {
+		return nil, CannotTestError
+	}
+	latestMinor := semver.MajorMinor(sterilize(releases[0]))
+	for _, r := range releases {
+		if semver.MajorMinor(sterilize(r)) != latestMinor {
+			return []string{r}, nil
+		}
+	}
+	return nil, CannotTestError
+}
+
+// LatestPatches picks the newest N patch releases of the latest minor version within the current major version,
+// eg: v1.4.1 and v1.4.0 for N 3 when the releases are v1.3.2, v1.4.0 and v1.4.1. Prereleases are skipped.
+type LatestPatches struct {
+	N int
+}
+
+func (p LatestPatches) Select(tags []string, currentMajorVer int) ([]string, error) {
+	releases := releasesWithinMajor(tags, currentMajorVer, false)
+	if len(releases) == 0 {
+		return nil, CannotTestError
+	}
+	latestMinor := semver.MajorMinor(sterilize(releases[0]))
+	var patches []string
+	for _, r := range releases {
+		if semver.MajorMinor(sterilize(r)) == latestMinor {
+			patches = append(patches, r)
+		}
+	}
+	return newest(patches, p.N)
+}
+
+// ExplicitTag picks the tag regardless of the current major version, it's an error when the source doesn't have it.
+type ExplicitTag string
+
+func (p ExplicitTag) Select(tags []string, _ int) ([]string, error) {
+	for _, tag := range tags {
+		if tag == string(p) {
+			return []string{tag}, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find tag %s", string(p))
+}
+
+// SemverConstraint picks the newest release that matches the constraint, like `>= 1.2.0, < 2.0.0` or `~> 1.4`, regardless of the current major version.
+// Prereleases match only when the constraint names a prerelease of the same version.
+type SemverConstraint string
+
+func (p SemverConstraint) Select(tags []string, _ int) ([]string, error) {
+	matched, err := matchConstraint(tags, string(p))
+	if err != nil {
+		return nil, err
+	}
+	return newest(matched, 1)
+}
+
+// ReleasesMatching picks every release that matches the constraint, newest first, like SemverConstraint.
+// It fits ModuleChainedUpgradeTest, eg: `>= 3.1.0, < 4.0.0` upgrades through every v3 release since v3.1.0.
+type ReleasesMatching string
+
+func (p ReleasesMatching) Select(tags []string, _ int) ([]string, error) {
+	matched, err := matchConstraint(tags, string(p))
+	if err != nil {
+		return nil, err
+	}
+	return newest(matched, len(matched))
+}
+
+func matchConstraint(tags []string, constraint string) ([]string, error) {
+	constraints, err := version.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid semver constraint %s: %s", constraint, err.Error())
+	}
+	var matched []string
+	for _, tag := range releases(tags, true) {
+		v, err := version.NewSemver(tag)
+		if err != nil {
+			continue
+		}
+		if constraints.Check(v) {
+			matched = append(matched, tag)
+		}
+	}
+	return matched, nil
+}
+
+// Baselines tests the tags picked by every policy, a policy that picks no tag is ignored unless all of them pick none.
+type Baselines []BaselinePolicy
+
+func (p Baselines) Select(tags []string, currentMajorVer int) ([]string, error) {
+	var selected []string
+	picked := make(map[string]bool)
+	for _, policy := range p {
+		s, err := policy.Select(tags, currentMajorVer)
+		if err == CannotTestError {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range s {
+			if !picked[tag] {
+				picked[tag] = true
+				selected = append(selected, tag)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, CannotTestError
+	}
+	return selected, nil
+}
+
+// selectsByMajorVersion tells whether policy only picks tags within the current major version, which are unstable v0 tags for a v0 module.
+// Baselines does when all of its policies do, other policies pick tags regardless of the current major version.
+func selectsByMajorVersion(policy BaselinePolicy) bool {
+	switch p := policy.(type) {
+	case LatestWithinMajor, PreviousMinor, LatestPatches:
+		return true
+	case Baselines:
+		return len(p) > 0 && linq.From(p).All(func(b interface{}) bool {
+			return selectsByMajorVersion(b.(BaselinePolicy))
+		})
+	}
+	return false
+}
+
+func selectBaselines(source BaselineSource, policy BaselinePolicy, currentMajorVer int) ([]string, error) {
+	tags, err := source.Tags()
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		return nil, fmt.Errorf("cannot find tags")
+	}
+	return policy.Select(tags, currentMajorVer)
+}
+
+// releases returns tags that are semantic versions, newest first. Prereleases are dropped unless includePrerelease is set.
+func releases(tags []string, includePrerelease bool) []string {
+	var r []string
+	for _, tag := range tags {
+		v := sterilize(tag)
+		if !semver.IsValid(v) {
+			continue
+		}
+		if !includePrerelease && semver.Prerelease(v) != "" {
+			continue
+		}
+		r = append(r, tag)
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return semver.Compare(sterilize(r[i]), sterilize(r[j])) > 0
+	})
+	return r
+}
+
+func releasesWithinMajor(tags []string, currentMajorVer int, includePrerelease bool) []string {
+	var r []string
+	for _, tag := range releases(tags, includePrerelease) {
+		if semver.Major(sterilize(tag)) == fmt.Sprintf("v%d", currentMajorVer) {
+			r = append(r, tag)
+		}
+	}
+	return r
+}
+
+func newest(releases []string, n int) ([]string, error) {
+	if len(releases) == 0 || n < 1 {
+		return nil, CannotTestError
+	}
+	if len(releases) > n {
+		releases = releases[:n]
+	}
+	return releases, nil
+}
@@ -0,0 +1,99 @@
+package terraform_module_test_helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var policyTestTags = []string{"v1.3.0", "v1.3.2", "v1.4.0", "v1.4.1", "v1.5.0-rc1", "v1.5.0-beta1", "v2.0.0", "v0.9.0", "latest", "1.2.0"}
+
+func TestBaselinePolicies(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   BaselinePolicy
+		expected []string
+	}{
+		{
+			name:     "latest within major",
+			policy:   LatestWithinMajor{},
+			expected: []string{"v1.5.0-beta1"},
+		},
+		{
+			name:     "latest within major including prerelease",
+			policy:   LatestWithinMajor{IncludePrerelease: true},
+			expected: []string{"v1.5.0-rc1"},
+		},
+		{
+			name:     "previous minor",
+			policy:   PreviousMinor{},
+			expected: []string{"v1.3.2"},
+		},
+		{
+			name:     "latest patches",
+			policy:   LatestPatches{N: 3},
+			expected: []string{"v1.4.1", "v1.4.0"},
+		},
+		{
+			name:     "explicit tag",
+			policy:   ExplicitTag("v1.3.0"),
+			expected: []string{"v1.3.0"},
+		},
+		{
+			name:     "semver constraint",
+			policy:   SemverConstraint("~> 1.3.0"),
+			expected: []string{"v1.3.2"},
+		},
+		{
+			name:     "semver constraint without v prefix",
+			policy:   SemverConstraint("< 1.3.0"),
+			expected: []string{"1.2.0"},
+		},
+		{
+			name:     "releases matching",
+			policy:   ReleasesMatching(">= 1.2.0, < 1.5.0"),
+			expected: []string{"v1.4.1", "v1.4.0", "v1.3.2", "v1.3.0", "1.2.0"},
+		},
+		{
+			name:     "baselines",
+			policy:   Baselines{PreviousMinor{}, SemverConstraint("~> 1.4.0"), SemverConstraint(">= 3.0.0"), ExplicitTag("v1.3.0")},
+			expected: []string{"v1.3.2", "v1.4.1", "v1.3.0"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tags, err := c.policy.Select(policyTestTags, 1)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, tags)
+		})
+	}
+}
+
+func TestBaselinePoliciesCannotTest(t *testing.T) {
+	for _, policy := range []BaselinePolicy{LatestWithinMajor{}, PreviousMinor{}, LatestPatches{N: 1}, SemverConstraint(">= 3.0.0"), ReleasesMatching(">= 3.0.0"), Baselines{PreviousMinor{}}} {
+		_, err := policy.Select([]string{"v2.0.0", "v3.0.0-rc1"}, 3)
+		assert.Equal(t, CannotTestError, err)
+	}
+	_, err := ExplicitTag("v9.9.9").Select(policyTestTags, 1)
+	assert.EqualError(t, err, "cannot find tag v9.9.9")
+	_, err = SemverConstraint("not a constraint").Select(policyTestTags, 1)
+	assert.Error(t, err)
+}
+
+func TestSelectsByMajorVersion(t *testing.T) {
+	assert.True(t, selectsByMajorVersion(LatestWithinMajor{}))
+	assert.True(t, selectsByMajorVersion(PreviousMinor{}))
+	assert.True(t, selectsByMajorVersion(LatestPatches{N: 2}))
+	assert.True(t, selectsByMajorVersion(Baselines{PreviousMinor{}, LatestPatches{N: 2}}))
+	assert.False(t, selectsByMajorVersion(ExplicitTag("v0.3.0")))
+	assert.False(t, selectsByMajorVersion(SemverConstraint("~> 0.3")))
+	assert.False(t, selectsByMajorVersion(ReleasesMatching(">= 0.1.0")))
+	assert.False(t, selectsByMajorVersion(Baselines{LatestWithinMajor{}, ExplicitTag("v0.3.0")}))
+	assert.False(t, selectsByMajorVersion(Baselines{}))
+}
+
+func TestReleasesSkipAllPrereleases(t *testing.T) {
+	assert.Equal(t, []string{"v2.0.0", "v1.4.1"}, releases([]string{"v1.4.1", "v1.5.0-beta1", "v2.0.0", "v2.1.0-preview", "v2.1.0-rc1"}, false))
+	assert.Equal(t, []string{"v2.1.0-rc1", "v2.1.0-preview", "v2.0.0"}, releases([]string{"v2.0.0", "v2.1.0-preview", "v2.1.0-rc1"}, true))
+}
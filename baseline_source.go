@@ -0,0 +1,210 @@
+package terraform_module_test_helper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-getter/v2"
+)
+
+// BaselineSource provides the released tags and code of a module, the baselines of upgrade tests.
+type BaselineSource interface {
+	// Tags returns all tag names, in any order.
+	Tags() ([]string, error)
+	// Checkout returns a folder containing the module's code at the tag, and a function that cleans it up.
+	Checkout(tag string) (string, func(), error)
+	String() string
+}
+
+var _ BaselineSource = GitHubSource{}
+var _ BaselineSource = LocalGitSource{}
+var _ BaselineSource = GitSource{}
+var _ BaselineSource = ArchiveSource{}
+
+// GitHubSource reads tags by GitHub API and downloads code by go-getter, set `GITHUB_TOKEN` to avoid rate limits.
+type GitHubSource struct {
+	Owner string
+	Repo  string
+}
+
+func (s GitHubSource) Tags() ([]string, error) {
+	return githubTags(s.Owner, s.Repo)
+}
+
+func (s GitHubSource) Checkout(tag string) (string, func(), error) {
+	dir, err := cloneGithubRepo(s.Owner, s.Repo, &tag)
+	return dir, func() {}, err
+}
+
+func (s GitHubSource) String() string {
+	return fmt.Sprintf("github.com/%s/%s", s.Owner, s.Repo)
+}
+
+// LocalGitSource reads tags from a local clone, and checks out the code by `git worktree add`, so no network is needed.
+// CI should fetch tags, eg: `actions/checkout` with `fetch-depth: 0`.
+type LocalGitSource struct {
+	Dir string
+}
+
+func (s LocalGitSource) Tags() ([]string, error) {
+	output, err := runGit(s.Dir, "tag", "--list")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+func (s LocalGitSource) Checkout(tag string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "baseline-")
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err = runGit(s.Dir, "worktree", "add", "--detach", dir, "refs/tags/"+tag); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return dir, func() {
+		_, _ = runGit(s.Dir, "worktree", "remove", "--force", dir)
+		_ = os.RemoveAll(dir)
+	}, nil
+}
+
+func (s LocalGitSource) String() string {
+	return fmt.Sprintf("local git repository %s", s.Dir)
+}
+
+// GitSource reads tags by `git ls-remote` and checks out the code by a shallow clone, from any git URL that git could access.
+type GitSource struct {
+	URL string
+}
+
+func (s GitSource) Tags() ([]string, error) {
+	output, err := runGit("", "ls-remote", "--tags", "--refs", s.URL)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.HasPrefix(fields[1], "refs/tags/") {
+			tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+		}
+	}
+	return tags, nil
+}
+
+func (s GitSource) Checkout(tag string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "baseline-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	if _, err = runGit("", "clone", "--quiet", "--depth", "1", "--branch", tag, s.URL, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+func (s GitSource) String() string {
+	return s.URL
+}
+
+var archiveExtensions = []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".zip"}
+var archiveVersion = regexp.MustCompile(`v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`)
+
+// ArchiveSource reads release archives from a folder, the tag is the version at the end of the archive's name,
+// like `terraform-azurerm-aks-v7.5.0.tar.gz` or `v7.5.0.zip`. An archive with a single top folder, like GitHub's source archive, is unwrapped.
+type ArchiveSource struct {
+	Dir string
+}
+
+func (s ArchiveSource) Tags() ([]string, error) {
+	archives, err := s.archives()
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(archives), nil
+}
+
+func (s ArchiveSource) Checkout(tag string) (string, func(), error) {
+	archives, err := s.archives()
+	if err != nil {
+		return "", nil, err
+	}
+	archive, ok := archives[tag]
+	if !ok {
+		return "", nil, fmt.Errorf("no archive for tag %s in %s", tag, s.Dir)
+	}
+	dir, err := os.MkdirTemp("", "baseline-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	if _, err = getter.Get(context.TODO(), dir, archive); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("cannot extract %s: %s", archive, err.Error())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), cleanup, nil
+	}
+	return dir, cleanup, nil
+}
+
+func (s ArchiveSource) String() string {
+	return fmt.Sprintf("release archives in %s", s.Dir)
+}
+
+// archives returns archives' absolute paths keyed by tag.
+func (s ArchiveSource) archives() (map[string]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	archives := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		for _, ext := range archiveExtensions {
+			if !strings.HasSuffix(entry.Name(), ext) {
+				continue
+			}
+			tag := archiveVersion.FindString(strings.TrimSuffix(entry.Name(), ext))
+			if tag == "" {
+				break
+			}
+			path, err := filepath.Abs(filepath.Join(s.Dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			archives[tag] = path
+			break
+		}
+	}
+	return archives, nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s\n%s", strings.Join(args, " "), err.Error(), string(output))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,85 @@
+package terraform_module_test_helper
+
+import (
+	"archive/zip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) {
+		_, err := runGit(repo, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.NoError(t, err)
+	}
+	git("init", "--quiet")
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.tf"), []byte("# v1.0.0"), 0600))
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "init")
+	git("tag", "v1.0.0")
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.tf"), []byte("# v1.1.0"), 0600))
+	git("commit", "--quiet", "-am", "bump")
+	git("tag", "v1.1.0")
+
+	source := LocalGitSource{Dir: repo}
+	tag, err := getLatestTag(source, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", tag)
+	dir, cleanup, err := source.Checkout("v1.0.0")
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, "# v1.0.0", string(content))
+	cleanup()
+	assert.False(t, files.FileExists(dir))
+}
+
+func TestArchiveSource(t *testing.T) {
+	archives := t.TempDir()
+	writeZip(t, filepath.Join(archives, "terraform-azurerm-aks-v1.0.0.zip"), map[string]string{
+		"terraform-azurerm-aks-1.0.0/main.tf": "# v1.0.0",
+	})
+	writeZip(t, filepath.Join(archives, "v1.1.0.zip"), map[string]string{
+		"main.tf":     "# v1.1.0",
+		"versions.tf": "",
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(archives, "README.md"), []byte(""), 0600))
+
+	source := ArchiveSource{Dir: archives}
+	tags, err := source.Tags()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, tags)
+	for _, tag := range tags {
+		dir, cleanup, err := source.Checkout(tag)
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+		require.NoError(t, err)
+		assert.Equal(t, "# "+tag, string(content))
+		cleanup()
+	}
+	_, _, err = source.Checkout("v2.0.0")
+	assert.Error(t, err)
+}
+
+func writeZip(t *testing.T, path string, content map[string]string) {
+	f, err := os.Create(filepath.Clean(path))
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	w := zip.NewWriter(f)
+	for name, c := range content {
+		entry, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(c))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	helper "github.com/Azure/terraform-module-test-helper"
+)
+
+// Usage:
+//
+//	janitor list [-max-age 6h]
+//	janitor clean [-max-age 6h] [-dry-run]
+//
+// An entry is stale when the test process that registered it is gone, or it's older than max-age.
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	maxAge := flags.Duration("max-age", 0, "treat entries older than this as stale, 0 means only entries whose test process is gone are stale")
+	dryRun := flags.Bool("dry-run", false, "only print stale entries that would be destroyed")
+	_ = flags.Parse(os.Args[2:])
+	switch command {
+	case "list":
+		list(*maxAge)
+	case "clean":
+		clean(*maxAge, *dryRun)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	_, _ = fmt.Fprintln(os.Stderr, "usage: janitor list|clean [-max-age duration] [-dry-run]")
+	os.Exit(2)
+}
+
+func list(maxAge time.Duration) {
+	entries, err := helper.LedgerEntries()
+	if err != nil {
+		panic(err.Error())
+	}
+	for _, e := range entries {
+		fmt.Printf("%s\t%s\t%s\tstale=%t\tkept=%t\t%s\n", e.StartTime.Format(time.RFC3339), e.Example, e.TestName, e.Stale(maxAge), e.Kept, e.Path)
+	}
+}
+
+func clean(maxAge time.Duration, dryRun bool) {
+	entries, err := helper.StaleLedgerEntries(maxAge)
+	if err != nil {
+		panic(err.Error())
+	}
+	failed := false
+	for _, e := range entries {
+		if dryRun {
+			fmt.Printf("would destroy %s (%s)\n", e.Path, e.TestName)
+			continue
+		}
+		fmt.Printf("destroying %s (%s)\n", e.Path, e.TestName)
+		if err = e.Destroy(); err != nil {
+			failed = true
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
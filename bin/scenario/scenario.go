@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const scenarioTestTemplate = `package scenario_test
+
+import (
+	"testing"
+
+	helper "github.com/Azure/terraform-module-test-helper"
+)
+
+func TestScenario(t *testing.T) {
+	for name, path := range map[string]string{%s} {
+		scenarioFilePath := path
+		t.Run(name, func(t *testing.T) {
+			helper.RunScenarioFile(t, scenarioFilePath)
+		})
+	}
+}
+`
+
+// Usage: scenario [go test flags] examples/startup/test.yaml [examples/complete/test.yaml ...]
+// It must run inside a Go module requiring this helper, it writes a test calling RunScenarioFile into a temporary folder of the module and runs it with `go test`.
+// Arguments that are existing files are scenario files, the others are passed to `go test`, like `-v` or `-timeout 3h`. There's no timeout by default.
+func main() {
+	var scenarios, flags []string
+	seen := make(map[string]bool)
+	for _, arg := range os.Args[1:] {
+		if info, err := os.Stat(arg); err == nil && !info.IsDir() && !strings.HasPrefix(arg, "-") {
+			abs, err := filepath.Abs(arg)
+			if err != nil {
+				exit(err)
+			}
+			if seen[filepath.ToSlash(arg)] {
+				continue
+			}
+			seen[filepath.ToSlash(arg)] = true
+			scenarios = append(scenarios, fmt.Sprintf("%q: %q", filepath.ToSlash(arg), abs))
+			continue
+		}
+		flags = append(flags, arg)
+	}
+	if len(scenarios) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: scenario [go test flags] <scenario file>...")
+		os.Exit(2)
+	}
+	dir, err := testDir()
+	if err != nil {
+		exit(err)
+	}
+	code := run(dir, scenarios, flags)
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testDir creates the test's folder in the current Go module, its name starts with "." so `go test ./...` ignores it.
+func testDir() (string, error) {
+	output, err := exec.Command("go", "env", "GOMOD").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the Go module: %w", err)
+	}
+	goMod := strings.TrimSpace(string(output))
+	if goMod == "" || goMod == os.DevNull {
+		return "", fmt.Errorf("scenario must run inside a Go module requiring github.com/Azure/terraform-module-test-helper")
+	}
+	return os.MkdirTemp(filepath.Dir(goMod), ".scenario-")
+}
+
+func run(dir string, scenarios, flags []string) int {
+	content := fmt.Sprintf(scenarioTestTemplate, strings.Join(scenarios, ", "))
+	if err := os.WriteFile(filepath.Join(dir, "scenario_test.go"), []byte(content), 0600); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	args := append([]string{"test", "-count=1", "-timeout=0", "-run=^TestScenario$"}, flags...)
+	cmd := exec.Command("go", append(args, "."+string(filepath.Separator)+filepath.Base(dir))...)
+	cmd.Dir = filepath.Dir(dir)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
+
+func exit(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
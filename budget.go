@@ -0,0 +1,87 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+)
+
+const (
+	maxDefaultDestroyBudget       = 15 * time.Minute
+	defaultIdempotentCheckBudget  = 5 * time.Minute
+	defaultAssertionBudget        = time.Minute
+	phaseIdempotentCheck          = "idempotent check"
+	phaseAssertion                = "assertion"
+	phaseApply                    = "apply"
+	destroyBudgetRatioOfRemaining = 4
+)
+
+// PhaseBudget splits the time left before the test's deadline, the earlier one of `go test -timeout` and TestOptions.Timeout.
+// A running Terraform command cannot be preempted, so before each phase we check whether the time left, after reserving Destroy, is enough for the phase.
+// Apply gets all the time that is not reserved, the idempotent check is skipped when there's not enough time for it, and the test fails when assertions cannot run.
+// The budget only decides whether a phase starts: an apply that started in time but runs longer than the time left eats into the Destroy reservation,
+// so give Destroy enough room for the slowest apply, or split examples that apply for long.
+type PhaseBudget struct {
+	// Destroy is the time reserved for destroy, default to a quarter of the time left when the test started, at most 15 minutes.
+	Destroy time.Duration
+	// IdempotentCheck is the minimal time needed by the idempotent check, default to 5 minutes.
+	IdempotentCheck time.Duration
+	// Assertion is the minimal time needed by assertions, default to 1 minute.
+	Assertion time.Duration
+}
+
+type phaseBudgeter struct {
+	deadline time.Time
+	budget   PhaseBudget
+	cut      []string
+}
+
+func newPhaseBudgeter(t testingT, start time.Time, timeout time.Duration, budget PhaseBudget) *phaseBudgeter {
+	b := &phaseBudgeter{budget: budget}
+	if deadline, ok := t.T().Deadline(); ok {
+		b.deadline = deadline
+	}
+	if timeout > 0 && (b.deadline.IsZero() || start.Add(timeout).Before(b.deadline)) {
+		b.deadline = start.Add(timeout)
+	}
+	if b.budget.Destroy == 0 && !b.deadline.IsZero() {
+		b.budget.Destroy = b.deadline.Sub(start) / destroyBudgetRatioOfRemaining
+		if b.budget.Destroy > maxDefaultDestroyBudget {
+			b.budget.Destroy = maxDefaultDestroyBudget
+		}
+	}
+	if b.budget.IdempotentCheck == 0 {
+		b.budget.IdempotentCheck = defaultIdempotentCheckBudget
+	}
+	if b.budget.Assertion == 0 {
+		b.budget.Assertion = defaultAssertionBudget
+	}
+	return b
+}
+
+// allow returns whether the phase could start, a phase that was not allowed is recorded as cut.
+func (b *phaseBudgeter) allow(t testingT, phase string, need time.Duration) bool {
+	if b.deadline.IsZero() {
+		return true
+	}
+	left := time.Until(b.deadline) - b.budget.Destroy
+	if left >= need {
+		return true
+	}
+	b.cut = append(b.cut, phase)
+	logger.Log(t, fmt.Sprintf("===> %s left before deadline %s, %s reserved for destroy, not enough for %s which needs %s, skip it", time.Until(b.deadline).Round(time.Second), b.deadline.Format(time.RFC3339), b.budget.Destroy, phase, need))
+	return false
+}
+
+func (b *phaseBudgeter) allowApply(t testingT) bool {
+	return b.allow(t, phaseApply, time.Nanosecond)
+}
+
+func (b *phaseBudgeter) allowIdempotentCheck(t testingT) bool {
+	return b.allow(t, phaseIdempotentCheck, b.budget.IdempotentCheck)
+}
+
+func (b *phaseBudgeter) allowAssertion(t testingT) bool {
+	return b.allow(t, phaseAssertion, b.budget.Assertion)
+}
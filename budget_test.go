@@ -0,0 +1,60 @@
+package terraform_module_test_helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseBudgeter_timeoutEarlierThanTestDeadline(t *testing.T) {
+	start := time.Now()
+	b := newPhaseBudgeter(newT(t), start, time.Minute, PhaseBudget{})
+	assert.Equal(t, start.Add(time.Minute), b.deadline)
+	assert.Equal(t, 15*time.Second, b.budget.Destroy)
+	assert.Equal(t, defaultIdempotentCheckBudget, b.budget.IdempotentCheck)
+	assert.Equal(t, defaultAssertionBudget, b.budget.Assertion)
+}
+
+func TestPhaseBudgeter_defaultDestroyBudgetShouldBeCapped(t *testing.T) {
+	b := newPhaseBudgeter(newT(t), time.Now(), 0, PhaseBudget{})
+	if b.deadline.IsZero() {
+		t.Skip("go test runs without timeout")
+	}
+	assert.LessOrEqual(t, b.budget.Destroy, maxDefaultDestroyBudget)
+}
+
+func TestPhaseBudgeter_cutPhasesWhenTimeIsShort(t *testing.T) {
+	b := newPhaseBudgeter(newT(t), time.Now(), time.Minute, PhaseBudget{
+		Assertion: 10 * time.Second,
+	})
+	assert.True(t, b.allowApply(newT(t)))
+	assert.False(t, b.allowIdempotentCheck(newT(t)))
+	assert.True(t, b.allowAssertion(newT(t)))
+	assert.Equal(t, []string{phaseIdempotentCheck}, b.cut)
+}
+
+func TestPhaseBudgeter_noTimeForApply(t *testing.T) {
+	b := newPhaseBudgeter(newT(t), time.Now(), time.Minute, PhaseBudget{
+		Destroy: time.Hour,
+	})
+	assert.False(t, b.allowApply(newT(t)))
+	assert.Equal(t, []string{phaseApply}, b.cut)
+}
+
+func TestPhaseBudgeter_noDeadlineAllowsEverything(t *testing.T) {
+	b := &phaseBudgeter{budget: PhaseBudget{Destroy: time.Hour, IdempotentCheck: time.Hour, Assertion: time.Hour}}
+	assert.True(t, b.allowApply(newT(t)))
+	assert.True(t, b.allowIdempotentCheck(newT(t)))
+	assert.True(t, b.allowAssertion(newT(t)))
+	assert.Empty(t, b.cut)
+}
+
+func TestVersionSnapshotToString_cutPhases(t *testing.T) {
+	snapshot := TestVersionSnapshot{
+		Time:      time.Now(),
+		Success:   true,
+		CutPhases: []string{phaseIdempotentCheck, phaseAssertion},
+	}
+	assert.Contains(t, snapshot.ToString(), "### Phases Cut By Deadline\n\nidempotent check\nassertion\n")
+}
@@ -0,0 +1,141 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"golang.org/x/mod/semver"
+)
+
+const currentCodeHop = "current"
+
+// ModuleChainedUpgradeTest applies the example of the oldest baseline picked by policy, then re-points the example's module source to each later baseline
+// in ascending order, and finally to currentModulePath. Every hop's plan must pass the change policy before it's applied and the chain moves on,
+// the test fails on the first hop that introduces drift or replacement, like `upgrade v3.2.0 -> v3.3.0 is not idempotent`. Every hop's verdict is written to the UpgradeReport.
+// Pick several baselines with policies like ReleasesMatching or LatestPatches, v0 tags are left out of the chain.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModuleChainedUpgradeTest(t *testing.T, source BaselineSource, policy BaselinePolicy, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int) {
+	ModuleChainedUpgradeTestWithOptions(t, source, moduleFolderRelativeToRoot, currentModulePath, opts, currentMajorVer, ModuleUpgradeOptions{Baseline: policy})
+}
+
+// ModuleChainedUpgradeTestWithOptions is ModuleChainedUpgradeTest with the baselines and the change policy every hop's plan must pass set by upgradeOpts.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModuleChainedUpgradeTestWithOptions(t *testing.T, source BaselineSource, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int, upgradeOpts ModuleUpgradeOptions) {
+	tryParallel(newT(t))
+	runModuleUpgradeTest(t, source, moduleFolderRelativeToRoot, opts, func(t *T, opts terraform.Options) error {
+		return chainedUpgrade(t, source, moduleFolderRelativeToRoot, currentModulePath, opts, currentMajorVer, upgradeOpts)
+	})
+}
+
+func chainedUpgrade(t *T, source BaselineSource, moduleFolderRelativeToRoot string, newModulePath string, opts terraform.Options, currentMajorVer int, upgradeOpts ModuleUpgradeOptions) error {
+	if currentMajorVer == 0 {
+		return SkipV0Error
+	}
+	policy := upgradeOpts.Baseline
+	if policy == nil {
+		policy = LatestWithinMajor{}
+	}
+	tags, err := selectBaselines(source, policy, currentMajorVer)
+	if err != nil {
+		return err
+	}
+	chain := upgradeChain(tags)
+	if len(chain) == 0 {
+		return SkipV0Error
+	}
+	logger.Log(t, fmt.Sprintf("===> upgrade chain: %v -> %s", chain, currentCodeHop))
+	report := newUpgradeReport(t, "chained", moduleFolderRelativeToRoot, chain[0])
+	return report.save(t, newModulePath, upgradeThroughChain(t, source, chain, moduleFolderRelativeToRoot, newModulePath, opts, upgradeOpts, report))
+}
+
+func upgradeThroughChain(t *T, source BaselineSource, chain []string, moduleFolderRelativeToRoot string, newModulePath string, opts terraform.Options, upgradeOpts ModuleUpgradeOptions, report *UpgradeReport) error {
+	var cleanups []func()
+	defer func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}()
+	oldest, cleanup, err := source.Checkout(chain[0])
+	if err != nil {
+		return err
+	}
+	cleanups = append(cleanups, cleanup)
+	if !files.FileExists(filepath.Join(oldest, moduleFolderRelativeToRoot)) {
+		return CannotTestError
+	}
+	tmpTestDir := test_structure.CopyTerraformFolderToTemp(t, oldest, moduleFolderRelativeToRoot)
+	defer func() {
+		removeWorkspace(t, tmpTestDir)
+	}()
+	opts.TerraformDir = tmpTestDir
+	if err = renderTemplates(t, opts); err != nil {
+		return err
+	}
+	opts, err = isolateEnv(opts)
+	if err != nil {
+		return err
+	}
+	entry := registerWorkspace(t, source.String(), moduleFolderRelativeToRoot, opts)
+	defer destroyTracked(t, opts, VerifyStateEmpty, entry)
+	initAndApply(t, &opts)
+	coordinator.failIfInterrupted(t)
+
+	from := chain[0]
+	redirects := exampleSourceRedirects(upgradeOpts.SourceRedirects)
+	for _, tag := range chain[1:] {
+		dir, cleanup, err := source.Checkout(tag)
+		if err != nil {
+			return err
+		}
+		cleanups = append(cleanups, cleanup)
+		verdict, err := upgradeHop(t, opts, upgradeOpts.Policy, redirects, dir, from, tag)
+		report.addHop(from, tag, verdict)
+		if err != nil {
+			return err
+		}
+		from, redirects = tag, []SourceRedirect{folderSourceRedirect(dir)}
+	}
+	verdict, err := upgradeHop(t, opts, upgradeOpts.Policy, redirects, newModulePath, from, currentCodeHop)
+	report.addHop(from, currentCodeHop, verdict)
+	return err
+}
+
+// upgradeHop points the example to the next version, then the plan must pass the upgrade policy, the new version is applied so the next hop starts from its state.
+func upgradeHop(t *T, opts terraform.Options, policy ChangePolicy, redirects []SourceRedirect, newModuleSource, from, to string) (ChangeVerdict, error) {
+	if err := redirectModuleSourcesE(opts.TerraformDir, redirects, newModuleSource); err != nil {
+		return ChangeVerdict{}, err
+	}
+	verdict, err := initAndPlanAndIdempotentAtEasyMode(t, opts, policy)
+	if err != nil {
+		return verdict, fmt.Errorf("upgrade %s -> %s is not idempotent: %w", from, to, err)
+	}
+	logger.Log(t, fmt.Sprintf("===> upgrade %s -> %s:\n%s", from, to, verdict))
+	if to == currentCodeHop {
+		return verdict, nil
+	}
+	initAndApply(t, &opts)
+	coordinator.failIfInterrupted(t)
+	return verdict, nil
+}
+
+// upgradeChain sorts tags from the oldest to the newest, v0 tags are dropped.
+func upgradeChain(tags []string) []string {
+	var chain []string
+	for _, tag := range tags {
+		if semver.Major(sterilize(tag)) != "v0" {
+			chain = append(chain, tag)
+		}
+	}
+	sort.SliceStable(chain, func(i, j int) bool {
+		return semver.Compare(sterilize(chain[i]), sterilize(chain[j])) < 0
+	})
+	return chain
+}
@@ -0,0 +1,66 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeChain(t *testing.T) {
+	assert.Equal(t, []string{"1.1.0", "v1.2.0", "v1.10.0"}, upgradeChain([]string{"v1.10.0", "v0.9.0", "1.1.0", "v1.2.0"}))
+	assert.Empty(t, upgradeChain([]string{"v0.9.0"}))
+}
+
+func TestUpgradeHopRedirectsModuleSourceThroughTheChain(t *testing.T) {
+	dir := t.TempDir()
+	mainTf := filepath.Join(dir, "main.tf")
+	require.NoError(t, os.WriteFile(mainTf, []byte(`module "this" {
+  source = "../.."
+}
+
+module "other" {
+  source = "Azure/other/azurerm"
+}
+`), 0600))
+	var sources []string
+	var policies []ChangePolicy
+	stub := gostub.Stub(&initAndPlanAndIdempotentAtEasyMode, func(t testingT, opts terraform.Options, policy ChangePolicy) (ChangeVerdict, error) {
+		policies = append(policies, policy)
+		content, err := os.ReadFile(filepath.Join(opts.TerraformDir, "main.tf"))
+		require.NoError(t, err)
+		sources = append(sources, string(content))
+		return ChangeVerdict{Passed: true}, nil
+	})
+	defer stub.Reset()
+	opts := terraform.Options{TerraformDir: dir}
+	allowUpdates := ChangePolicy{Allowed: []ChangeKind{ChangeUpdate}}
+	_, err := upgradeHop(newT(t), opts, allowUpdates, exampleSourceRedirects(nil), "/tmp/v1.1.0", "v1.0.0", currentCodeHop)
+	require.NoError(t, err)
+	_, err = upgradeHop(newT(t), opts, allowUpdates, []SourceRedirect{folderSourceRedirect("/tmp/v1.1.0")}, "/module", "v1.1.0", currentCodeHop)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	assert.Equal(t, []ChangePolicy{allowUpdates, allowUpdates}, policies)
+	assert.Contains(t, sources[0], `source = "/tmp/v1.1.0"`)
+	assert.Contains(t, sources[1], `source = "/module"`)
+	assert.Contains(t, sources[1], `source = "Azure/other/azurerm"`)
+}
+
+func TestUpgradeHopReportsDriftingHop(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`module "this" {
+  source = "../.."
+}
+`), 0600))
+	stub := gostub.Stub(&initAndPlanAndIdempotentAtEasyMode, func(t testingT, opts terraform.Options, policy ChangePolicy) (ChangeVerdict, error) {
+		return ChangeVerdict{}, fmt.Errorf("terraform configuration not idempotent:drift")
+	})
+	defer stub.Reset()
+	_, err := upgradeHop(newT(t), terraform.Options{TerraformDir: dir}, ChangePolicy{}, exampleSourceRedirects(nil), "/tmp/v3.3.0", "v3.2.0", "v3.3.0")
+	assert.EqualError(t, err, "upgrade v3.2.0 -> v3.3.0 is not idempotent: terraform configuration not idempotent:drift")
+}
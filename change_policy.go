@@ -0,0 +1,168 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+)
+
+// ChangeKind is what a planned change does to a resource.
+type ChangeKind string
+
+const (
+	ChangeCreate  ChangeKind = "create"
+	ChangeRead    ChangeKind = "read"
+	ChangeUpdate  ChangeKind = "update"
+	ChangeReplace ChangeKind = "replace"
+	ChangeDelete  ChangeKind = "delete"
+)
+
+var changeKinds = []ChangeKind{ChangeCreate, ChangeRead, ChangeUpdate, ChangeReplace, ChangeDelete}
+
+// ChangePolicy decides which planned changes fail idempotent and upgrade checks. The zero value fails any change.
+type ChangePolicy struct {
+	// Ignores are regular expressions matched against resource addresses, matched resources' changes are left out of the verdict.
+	Ignores []string
+	// Allowed are the kinds of changes that don't fail the check, eg: `[]ChangeKind{ChangeUpdate}` allows in-place updates but fails replacements and deletions.
+	Allowed []ChangeKind
+}
+
+func (p ChangePolicy) withIgnores(ignores []string) ChangePolicy {
+	if len(ignores) == 0 {
+		return p
+	}
+	p.Ignores = append(append([]string{}, p.Ignores...), ignores...)
+	return p
+}
+
+// ClassifiedChange is a planned change of a resource with why Terraform plans it, ActionReason and ReplacePaths come from the plan's JSON, like `replace_because_cannot_update`.
+type ClassifiedChange struct {
+	Address      string        `json:"address"`
+	ProviderName string        `json:"provider_name,omitempty"`
+	Kind         ChangeKind    `json:"kind"`
+	Actions      []string      `json:"actions"`
+	ActionReason string        `json:"action_reason,omitempty"`
+	ReplacePaths []interface{} `json:"replace_paths,omitempty"`
+	Allowed      bool          `json:"allowed"`
+}
+
+// String returns the change like `azurerm_subnet.this: replace (delete, create) because replace_because_cannot_update, replace paths [["name"]]`.
+func (c ClassifiedChange) String() string {
+	s := fmt.Sprintf("%s: %s", c.Address, c.Kind)
+	if c.Kind == ChangeReplace {
+		s = fmt.Sprintf("%s (%s)", s, strings.Join(c.Actions, ", "))
+	}
+	if c.ActionReason != "" {
+		s = fmt.Sprintf("%s because %s", s, c.ActionReason)
+	}
+	if len(c.ReplacePaths) > 0 {
+		s = fmt.Sprintf("%s, replace paths %s", s, typeString(c.ReplacePaths))
+	}
+	if c.Allowed {
+		s = fmt.Sprintf("%s (allowed)", s)
+	}
+	return s
+}
+
+// ChangeVerdict is the result of checking a plan against a ChangePolicy, Changes are sorted by address and never contain no-op changes.
+type ChangeVerdict struct {
+	Passed  bool               `json:"passed"`
+	Changes []ClassifiedChange `json:"changes,omitempty"`
+}
+
+func (v ChangeVerdict) String() string {
+	if len(v.Changes) == 0 {
+		return "No resource changes"
+	}
+	var lines []string
+	for _, c := range v.Changes {
+		lines = append(lines, fmt.Sprintf("  %s", c))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p ChangePolicy) verdict(changes map[string]*tfjson.ResourceChange, actionReasons map[string]string) (ChangeVerdict, error) {
+	changes, err := ignoreChanges(changes, p.Ignores)
+	if err != nil {
+		return ChangeVerdict{}, err
+	}
+	verdict := ChangeVerdict{Passed: true}
+	for _, address := range sortedKeys(changes) {
+		c, ok := classifyChange(changes[address], actionReasons[address])
+		if !ok {
+			continue
+		}
+		c.Address = address
+		c.Allowed = linq.From(p.Allowed).Contains(c.Kind)
+		verdict.Passed = verdict.Passed && c.Allowed
+		verdict.Changes = append(verdict.Changes, c)
+	}
+	return verdict, nil
+}
+
+// classifyChange returns false for a no-op change. Actions that don't match any ChangeKind, like Terraform's `forget`, are kept as they are.
+func classifyChange(change *tfjson.ResourceChange, actionReason string) (ClassifiedChange, bool) {
+	if change.Change == nil || change.Change.Actions == nil || change.Change.Actions.NoOp() {
+		return ClassifiedChange{}, false
+	}
+	actions := change.Change.Actions
+	c := ClassifiedChange{
+		Address:      change.Address,
+		ProviderName: change.ProviderName,
+		ActionReason: actionReason,
+	}
+	for _, action := range actions {
+		c.Actions = append(c.Actions, string(action))
+	}
+	switch {
+	case actions.Replace():
+		c.Kind = ChangeReplace
+		c.ReplacePaths = change.Change.ReplacePaths
+	case actions.Update():
+		c.Kind = ChangeUpdate
+	case actions.Delete():
+		c.Kind = ChangeDelete
+	case actions.Create():
+		c.Kind = ChangeCreate
+	case actions.Read():
+		c.Kind = ChangeRead
+	default:
+		c.Kind = ChangeKind(strings.Join(c.Actions, ", "))
+	}
+	return c, true
+}
+
+// initAndPlanWithActionReasons is initAndPlanWithStruct that also returns the changes' `action_reason` keyed by address, which tfjson doesn't read.
+func initAndPlanWithActionReasons(t terratest.TestingT, options terraform.Options) (*terraform.PlanStruct, map[string]string) {
+	planJson := initAndPlanWithJson(t, options)
+	plan, err := terraform.ParsePlanJSON(planJson)
+	require.NoError(t, err)
+	reasons, err := actionReasons(planJson)
+	require.NoError(t, err)
+	return plan, reasons
+}
+
+func actionReasons(planJson string) (map[string]string, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Address      string `json:"address"`
+			ActionReason string `json:"action_reason"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal([]byte(planJson), &plan); err != nil {
+		return nil, fmt.Errorf("cannot parse plan: %s", err.Error())
+	}
+	reasons := make(map[string]string)
+	for _, c := range plan.ResourceChanges {
+		if c.ActionReason != "" {
+			reasons[c.Address] = c.ActionReason
+		}
+	}
+	return reasons, nil
+}
@@ -0,0 +1,97 @@
+package terraform_module_test_helper
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func planChanges() map[string]*tfjson.ResourceChange {
+	return map[string]*tfjson.ResourceChange{
+		"azurerm_resource_group.this": {
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}},
+		},
+		"azurerm_subnet.this": {
+			Change: &tfjson.Change{
+				Actions:      tfjson.Actions{tfjson.ActionCreate, tfjson.ActionDelete},
+				ReplacePaths: []interface{}{[]interface{}{"name"}},
+			},
+		},
+		"azurerm_virtual_network.this": {
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}},
+		},
+		"azurerm_public_ip.this": {
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}},
+		},
+		"data.azurerm_client_config.this": {
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}},
+		},
+	}
+}
+
+func TestChangePolicyVerdict(t *testing.T) {
+	reasons := map[string]string{
+		"azurerm_subnet.this":          "replace_because_cannot_update",
+		"azurerm_virtual_network.this": "delete_because_no_resource_config",
+	}
+	verdict, err := ChangePolicy{}.verdict(planChanges(), reasons)
+	require.NoError(t, err)
+	assert.False(t, verdict.Passed)
+	assert.Equal(t, `  azurerm_resource_group.this: update
+  azurerm_subnet.this: replace (create, delete) because replace_because_cannot_update, replace paths [["name"]]
+  azurerm_virtual_network.this: delete because delete_because_no_resource_config
+  data.azurerm_client_config.this: read`, verdict.String())
+
+	verdict, err = ChangePolicy{Allowed: []ChangeKind{ChangeUpdate, ChangeRead}}.verdict(planChanges(), reasons)
+	require.NoError(t, err)
+	assert.False(t, verdict.Passed)
+	var disallowed []string
+	for _, c := range verdict.Changes {
+		if !c.Allowed {
+			disallowed = append(disallowed, c.Address)
+		}
+	}
+	assert.Equal(t, []string{"azurerm_subnet.this", "azurerm_virtual_network.this"}, disallowed)
+
+	verdict, err = ChangePolicy{
+		Ignores: []string{`^azurerm_(subnet|virtual_network)\.`},
+		Allowed: []ChangeKind{ChangeUpdate, ChangeRead},
+	}.verdict(planChanges(), reasons)
+	require.NoError(t, err)
+	assert.True(t, verdict.Passed)
+	assert.Len(t, verdict.Changes, 2)
+
+	verdict, err = ChangePolicy{}.verdict(map[string]*tfjson.ResourceChange{
+		"azurerm_public_ip.this": {Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+	}, nil)
+	require.NoError(t, err)
+	assert.True(t, verdict.Passed)
+	assert.Equal(t, "No resource changes", verdict.String())
+
+	_, err = ChangePolicy{Ignores: []string{"("}}.verdict(planChanges(), nil)
+	assert.Error(t, err)
+}
+
+func TestChangePolicyWithIgnores(t *testing.T) {
+	policy := ChangePolicy{Ignores: []string{"a"}}
+	merged := policy.withIgnores([]string{"b"})
+	assert.Equal(t, []string{"a", "b"}, merged.Ignores)
+	assert.Equal(t, []string{"a"}, policy.Ignores)
+}
+
+func TestActionReasons(t *testing.T) {
+	reasons, err := actionReasons(`{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "azurerm_subnet.this", "change": {"actions": ["delete", "create"]}, "action_reason": "replace_because_tainted"},
+    {"address": "azurerm_resource_group.this", "change": {"actions": ["update"]}}
+  ]
+}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"azurerm_subnet.this": "replace_because_tainted"}, reasons)
+
+	_, err = actionReasons("not json")
+	assert.Error(t, err)
+}
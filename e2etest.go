@@ -5,7 +5,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sync"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,35 +15,90 @@ import (
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/stretchr/testify/require"
 )
 
 type TestOptions struct {
-	TerraformOptions    terraform.Options
-	Assertion           func(*testing.T, TerraformOutput)
+	TerraformOptions terraform.Options
+	Assertion        func(*testing.T, TerraformOutput)
+	// StateAssertion receives the outputs and the parsed `terraform show -json` state after apply.
+	StateAssertion      func(*testing.T, TerraformOutput, *TerraformState)
+	PlanAssertion       func(*testing.T, *terraform.PlanStruct)
 	SkipIdempotentCheck bool
 	SkipDestroy         bool
+	// IdempotentIgnores are regular expressions matched against resource addresses, matched resources' changes are ignored by the idempotent check.
+	IdempotentIgnores []string
+	// IdempotentPolicy decides which changes fail the idempotent check, like `ChangePolicy{Allowed: []ChangeKind{ChangeUpdate}}`, IdempotentIgnores are added to its Ignores.
+	IdempotentPolicy ChangePolicy
+	// DestroyVerification controls how we verify that no resource is left after destroy. The zero value VerifyStateEmpty verifies the state,
+	// so tests that don't set it get the verification too, set SkipDestroyVerification to opt out.
+	DestroyVerification DestroyVerification
+	// KeepWorkspace keeps the copied workspace, including state file and `.terraform` folder, for debugging. Destroy is skipped when the workspace is kept.
+	KeepWorkspace KeepWorkspace
+	// Timeout is the deadline PhaseBudget plans the phases against, along with `go test -timeout`. Running Terraform commands aren't stopped at it,
+	// so the test also fails afterwards when the whole run, including destroy, took longer than it. Zero means no limit.
+	Timeout time.Duration
+	// PhaseBudget splits the time left before the deadline across phases, so destroy starts early enough unless a running apply overruns its share.
+	PhaseBudget PhaseBudget
+	// Weight is how much of the scheduler's capacity the test holds from apply to destroy, default to the ResourceClass's weight, or 1.
+	Weight int
+	// ResourceClass names a weight configured in the scheduler, like "aks".
+	ResourceClass string
+	// prepareWorkspace modifies the copied example before init, like pinning provider versions.
+	prepareWorkspace func(dir string) error
 }
 
+// DestroyVerification is how destroy checks that no resource is left. The zero value is VerifyStateEmpty, so every existing caller verifies the state after destroy.
+type DestroyVerification int
+
+const (
+	// VerifyStateEmpty fails the test when there are still managed resources in the state after destroy.
+	VerifyStateEmpty DestroyVerification = iota
+	// VerifyStateEmptyWithRefresh runs a refresh-only plan for the resources left in the state, only resources that still exist fail the test.
+	VerifyStateEmptyWithRefresh
+	// SkipDestroyVerification doesn't check the state after destroy, for examples whose resources outlive destroy on purpose.
+	SkipDestroyVerification
+)
+
 var copyLock = &KeyedMutex{}
-var initLock = &sync.Mutex{}
 
 type TerraformOutput = map[string]interface{}
 
 type testExecutor interface {
-	TearDown(t testingT, rootDir string, modulePath string)
+	TearDown(t testingT, rootDir string, modulePath string, details *testRunDetails)
 	Logger() logger.TestLogger
 }
 
+// testRunDetails collects information during the test run that would be recorded in TestRecord.
+type testRunDetails struct {
+	KeptWorkspace   string
+	CutPhases       []string
+	CapacityWait    time.Duration
+	TerraformBinary string
+}
+
 var _ testExecutor = e2eTestExecutor{}
 
-type e2eTestExecutor struct{}
+type e2eTestExecutor struct {
+	// matrix collects the snapshot instead of saving it, when the test is one of a binary matrix.
+	matrix      *matrixRecord
+	matrixIndex int
+}
 
-func (e2eTestExecutor) TearDown(t testingT, rootDir string, modulePath string) {
+func (e e2eTestExecutor) TearDown(t testingT, rootDir string, modulePath string, details *testRunDetails) {
 	s := SuccessTestVersionSnapshot(rootDir, modulePath)
 	if t.Failed() {
 		s = FailedTestVersionSnapshot(rootDir, modulePath, t.ErrorMessage())
 	}
+	s.KeptWorkspace = details.KeptWorkspace
+	s.CutPhases = details.CutPhases
+	s.CapacityWait = details.CapacityWait
+	s.TerraformBinary = details.TerraformBinary
+	if e.matrix != nil {
+		e.matrix.add(e.matrixIndex, s)
+		return
+	}
 	require.NoError(t, s.Save(t))
 }
 
@@ -56,24 +112,57 @@ func RunE2ETest(t *testing.T, moduleRootPath, exampleRelativePath string, option
 }
 
 func runE2ETest(t testingT, moduleRootPath, exampleRelativePath string, option terraform.Options, assertion func(*testing.T, TerraformOutput)) {
-	initAndApplyAndIdempotentTest(t, moduleRootPath, exampleRelativePath, option, false, false, assertion, e2eTestExecutor{})
+	initAndApplyAndIdempotentTest(t, moduleRootPath, exampleRelativePath, TestOptions{
+		TerraformOptions: option,
+		Assertion:        assertion,
+	}, e2eTestExecutor{})
 }
 
 func RunE2ETestWithOption(t *testing.T, moduleRootPath, exampleRelativePath string, testOption TestOptions) {
-	initAndApplyAndIdempotentTest(newT(t), moduleRootPath, exampleRelativePath, testOption.TerraformOptions, false, testOption.SkipIdempotentCheck, testOption.Assertion, e2eTestExecutor{})
+	initAndApplyAndIdempotentTest(newT(t), moduleRootPath, exampleRelativePath, testOption, e2eTestExecutor{})
 }
 
-func initAndApplyAndIdempotentTest(t testingT, moduleRootPath string, exampleRelativePath string, option terraform.Options, skipDestroy bool, skipCheckIdempotent bool, assertion func(*testing.T, TerraformOutput), executor testExecutor) {
+func initAndApplyAndIdempotentTest(t testingT, moduleRootPath string, exampleRelativePath string, testOption TestOptions, executor testExecutor) {
 	tryParallel(t)
-	defer executor.TearDown(t, moduleRootPath, exampleRelativePath)
+	defer coordinator.start(t)()
+	details := &testRunDetails{TerraformBinary: testOption.TerraformOptions.TerraformBinary}
+	defer executor.TearDown(t, moduleRootPath, exampleRelativePath, details)
+	start := time.Now()
+	if testOption.Timeout > 0 {
+		defer assertDurationWithin(t, start, testOption.Timeout)
+	}
+	budget := newPhaseBudgeter(t, start, testOption.Timeout, testOption.PhaseBudget)
+	defer func() {
+		details.CutPhases = budget.cut
+	}()
 	testDir := filepath.Join(moduleRootPath, exampleRelativePath)
 	logger.Log(t, fmt.Sprintf("===> Starting test for %s, since we're running tests in parallel, the test log will be buffered and output to stdout after the test was finished.", testDir))
 
 	tmpDir := copyTerraformFolderToTemp(t, moduleRootPath, exampleRelativePath)
+	option := testOption.TerraformOptions
+	option.TerraformDir = tmpDir
+	require.NoError(t, renderTemplates(t, option))
+	if testOption.prepareWorkspace != nil {
+		require.NoError(t, testOption.prepareWorkspace(tmpDir))
+	}
+	option, err := isolateEnv(option)
+	require.NoError(t, err)
+	entry := registerWorkspace(t, moduleRootPath, exampleRelativePath, option)
 	defer func() {
-		_ = os.RemoveAll(filepath.Clean(tmpDir))
+		if testOption.KeepWorkspace.keep(t) {
+			kept, err := keepWorkspace(t, tmpDir, exampleRelativePath, option)
+			if err == nil {
+				details.KeptWorkspace = kept
+				_ = entry.moveTo(kept)
+				return
+			}
+			t.Errorf("cannot keep workspace %s: %s", tmpDir, err.Error())
+		}
+		if testOption.SkipDestroy {
+			_ = entry.Remove()
+		}
+		removeWorkspace(t, tmpDir)
 	}()
-	option.TerraformDir = tmpDir
 
 	l := executor.Logger()
 	c, ok := l.(io.Closer)
@@ -85,22 +174,60 @@ func initAndApplyAndIdempotentTest(t testingT, moduleRootPath string, exampleRel
 	option.Logger = logger.New(l)
 	option = setupRetryLogic(option)
 
-	if !skipDestroy {
-		defer destroy(t, option)
+	release := func() {}
+	defer func() {
+		release()
+	}()
+	if !testOption.SkipDestroy {
+		defer func() {
+			if testOption.KeepWorkspace.keep(t) {
+				return
+			}
+			destroyTracked(t, option, testOption.DestroyVerification, entry)
+		}()
+	}
+	if testOption.PlanAssertion != nil {
+		testOption.PlanAssertion(t.T(), initAndPlanWithStruct(t, option))
+	}
+	release, details.CapacityWait, err = currentScheduler().acquire(t, testOption.Weight, testOption.ResourceClass)
+	require.NoError(t, err)
+	coordinator.failIfInterrupted(t)
+	if !budget.allowApply(t) {
+		t.Fatalf("not enough time left to apply before the deadline")
 	}
 	initAndApply(t, &option)
-	var err error
-	if !skipCheckIdempotent {
-		err = initAndPlanAndIdempotentAtEasyMode(t, option)
+	coordinator.failIfInterrupted(t)
+	if !testOption.SkipIdempotentCheck && budget.allowIdempotentCheck(t) {
+		_, err = initAndPlanAndIdempotentAtEasyMode(t, option, testOption.IdempotentPolicy.withIgnores(testOption.IdempotentIgnores))
 	}
 	require.NoError(t, err)
-	if assertion != nil {
-		assertion(t.T(), terraform.OutputAll(t, removeLogger(option)))
+	coordinator.failIfInterrupted(t)
+	if (testOption.Assertion != nil || testOption.StateAssertion != nil) && !budget.allowAssertion(t) {
+		t.Errorf("not enough time left to run %s before the deadline, the test is not verified", phaseAssertion)
+		return
+	}
+	if testOption.Assertion != nil {
+		testOption.Assertion(t.T(), terraform.OutputAll(t, removeLogger(option)))
+	}
+	if testOption.StateAssertion != nil {
+		state, err := showState(t, option)
+		require.NoError(t, err)
+		testOption.StateAssertion(t.T(), terraform.OutputAll(t, removeLogger(option)), state)
+	}
+}
+
+// assertDurationWithin fails the test when it took longer than timeout, it runs after destroy and doesn't stop anything.
+func assertDurationWithin(t testingT, start time.Time, timeout time.Duration) {
+	if elapsed := time.Since(start); elapsed > timeout {
+		t.Errorf("test took %s, exceeds timeout %s", elapsed.Round(time.Second), timeout)
 	}
 }
 
 func copyTerraformFolderToTemp(t testingT, moduleRootPath string, exampleRelativePath string) string {
-	unlock := copyLock.Lock(exampleRelativePath)
+	source, err := filepath.Abs(filepath.Join(moduleRootPath, exampleRelativePath))
+	require.NoError(t, err)
+	unlock, err := copyLock.LockE(source)
+	require.NoError(t, err)
 	defer unlock()
 	tmpDir := test_structure.CopyTerraformFolderToTemp(t, moduleRootPath, exampleRelativePath)
 	return tmpDir
@@ -111,18 +238,49 @@ func initAndApply(t terratest.TestingT, options *terraform.Options) string {
 	return terraform.Apply(t, options)
 }
 
+func initAndPlanWithStruct(t terratest.TestingT, options terraform.Options) *terraform.PlanStruct {
+	plan, err := terraform.ParsePlanJSON(initAndPlanWithJson(t, options))
+	require.NoError(t, err)
+	return plan
+}
+
+func initAndPlanWithJson(t terratest.TestingT, options terraform.Options) string {
+	options.PlanFilePath = filepath.Join(options.TerraformDir, "tf.plan")
+	defer func() {
+		_ = os.Remove(options.PlanFilePath)
+	}()
+	tfInit(t, &options)
+	terraform.Plan(t, &options)
+	return terraform.Show(t, &options)
+}
+
 func tfInit(t terratest.TestingT, options *terraform.Options) {
-	initLock.Lock()
-	defer initLock.Unlock()
-	terraform.Init(t, options)
+	output, err := initWithPluginCache(t, options, terraform.InitE)
+	require.NoError(t, err, output)
 }
 
-func destroy(t testingT, option terraform.Options) {
+// destroy returns false when resources remain after destroy, a failed destroy stops the test.
+func destroy(t testingT, option terraform.Options, verification DestroyVerification) bool {
 	path := option.TerraformDir
 	if !files.IsExistingDir(path) || !files.FileExists(filepath.Join(path, "terraform.tfstate")) {
-		return
+		return true
+	}
+
+	require.NoError(t, destroyE(t, option))
+	if verification == SkipDestroyVerification {
+		return true
+	}
+	remains, err := remainingResources(t, option, verification == VerifyStateEmptyWithRefresh)
+	require.NoError(t, err)
+	if len(remains) > 0 {
+		t.Errorf("resources remain after destroy:\n%s", strings.Join(remains, "\n"))
+		return false
 	}
+	return true
+}
 
+// destroyE retries destroy on any error, then falls back to destroy with refresh.
+func destroyE(t terratest.TestingT, option terraform.Options) error {
 	option.MaxRetries = 5
 	option.TimeBetweenRetries = time.Minute
 	option.RetryableTerraformErrors = map[string]string{
@@ -132,7 +290,61 @@ func destroy(t testingT, option terraform.Options) {
 	if err != nil {
 		_, err = terraform.DestroyE(t, &option)
 	}
-	require.NoError(t, err)
+	return err
+}
+
+// remainingResources returns managed resources' addresses left in the state. With refresh, resources that have been deleted outside of Terraform are not counted.
+func remainingResources(t testingT, option terraform.Options, refresh bool) ([]string, error) {
+	opts := removeLogger(option)
+	output, err := terraform.RunTerraformCommandAndGetStdoutE(t, opts, "state", "list")
+	if err != nil {
+		return nil, err
+	}
+	var remains []string
+	for _, address := range strings.Split(output, "\n") {
+		address = strings.TrimSpace(address)
+		if address == "" || isDataSourceAddress(address) {
+			continue
+		}
+		remains = append(remains, address)
+	}
+	if len(remains) == 0 || !refresh {
+		return remains, nil
+	}
+	opts.PlanFilePath = filepath.Join(opts.TerraformDir, "refresh.tfplan")
+	defer func() {
+		_ = os.Remove(opts.PlanFilePath)
+	}()
+	if _, err = terraform.RunTerraformCommandE(t, opts, terraform.FormatArgs(opts, "plan", "-refresh-only", "-input=false", "-lock=false")...); err != nil {
+		return nil, err
+	}
+	plan, err := terraform.ShowWithStructE(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	return survivedResources(remains, plan.RawPlan.ResourceDrift), nil
+}
+
+func survivedResources(remains []string, drifts []*tfjson.ResourceChange) []string {
+	deleted := make(map[string]bool)
+	for _, drift := range drifts {
+		if drift.Change != nil && drift.Change.Actions.Delete() {
+			deleted[drift.Address] = true
+		}
+	}
+	var survived []string
+	for _, address := range remains {
+		if !deleted[address] {
+			survived = append(survived, address)
+		}
+	}
+	return survived
+}
+
+var dataSourceAddressRegex = regexp.MustCompile(`^(module\.[^.\[]+(\[[^\]]*\])?\.)*data\.`)
+
+func isDataSourceAddress(address string) bool {
+	return dataSourceAddressRegex.MatchString(address)
 }
 
 func removeLogger(option terraform.Options) *terraform.Options {
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/prashantv/gostub"
 	"github.com/stretchr/testify/assert"
 	"github.com/timandy/routine"
@@ -37,14 +38,14 @@ func TestE2EExample_testFail(t *testing.T) {
 func TestE2EExample_WithoutIdempotent(t *testing.T) {
 	currentId := routine.Goid()
 	originStub := initAndPlanAndIdempotentAtEasyMode
-	stub := gostub.Stub(&initAndPlanAndIdempotentAtEasyMode, func(t testingT, opts terraform.Options) error {
+	stub := gostub.Stub(&initAndPlanAndIdempotentAtEasyMode, func(t testingT, opts terraform.Options, policy ChangePolicy) (ChangeVerdict, error) {
 		// Do not impact other tests.
 		id := routine.Goid()
 		if id != currentId {
-			return originStub(t, opts)
+			return originStub(t, opts, policy)
 		}
 		assert.FailNow(t, "should not be called")
-		return nil
+		return ChangeVerdict{}, nil
 	})
 	defer stub.Reset()
 	RunE2ETestWithOption(t, "./", "example/basic",
@@ -75,6 +76,29 @@ func TestE2EExampleTest_setEnvWontCausePanicOnParallel(t *testing.T) {
 	}
 }
 
+func TestIsDataSourceAddress(t *testing.T) {
+	assert.True(t, isDataSourceAddress("data.azurerm_client_config.current"))
+	assert.True(t, isDataSourceAddress(`module.aks.data.azurerm_resource_group.this`))
+	assert.True(t, isDataSourceAddress(`module.aks["a"].module.node_pool[0].data.azurerm_subnet.this`))
+	assert.False(t, isDataSourceAddress("azurerm_resource_group.data"))
+	assert.False(t, isDataSourceAddress("module.data.azurerm_resource_group.this"))
+}
+
+func TestSurvivedResources(t *testing.T) {
+	remains := []string{"azurerm_resource_group.this", "azurerm_virtual_network.this"}
+	drifts := []*tfjson.ResourceChange{
+		{
+			Address: "azurerm_resource_group.this",
+			Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}},
+		},
+		{
+			Address: "azurerm_virtual_network.this",
+			Change:  &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}},
+		},
+	}
+	assert.Equal(t, []string{"azurerm_virtual_network.this"}, survivedResources(remains, drifts))
+}
+
 func TestE2EExampleTest_failedTestShouldGenerateErrorMessage(t *testing.T) {
 
 }
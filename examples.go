@@ -0,0 +1,117 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/stretchr/testify/require"
+)
+
+const defaultExamplesFolder = "examples"
+
+type ExamplesOptions struct {
+	// ExamplesFolder is relative to the module root, defaults to `examples`.
+	ExamplesFolder string
+	// Examples are test options keyed by example path relative to ExamplesFolder, eg: `startup` or `multiple_node_pools/basic`.
+	Examples map[string]TestOptions
+	// Skips are skip reasons keyed by example path relative to ExamplesFolder.
+	Skips map[string]string
+}
+
+// RunAllExamples discovers every example under the examples folder and runs each of them as a parallel subtest.
+// An example is tested with its entry in ExamplesOptions.Examples, or with its `test.yaml` scenario file, an example without any of them fails the test.
+func RunAllExamples(t *testing.T, moduleRootPath string, opts ExamplesOptions) {
+	examplesFolder := opts.ExamplesFolder
+	if examplesFolder == "" {
+		examplesFolder = defaultExamplesFolder
+	}
+	examples, err := discoverExamples(filepath.Join(moduleRootPath, examplesFolder))
+	require.NoError(t, err)
+	require.NoError(t, opts.checkUnknownExamples(examples))
+	for _, e := range examples {
+		example := e
+		t.Run(example, func(t *testing.T) {
+			if reason, ok := opts.Skips[example]; ok {
+				t.Skip(reason)
+			}
+			exampleRelativePath := filepath.ToSlash(filepath.Join(examplesFolder, example))
+			if testOption, ok := opts.Examples[example]; ok {
+				RunE2ETestWithOption(t, moduleRootPath, exampleRelativePath, testOption)
+				return
+			}
+			scenarioFile := filepath.Join(moduleRootPath, exampleRelativePath, scenarioFileName)
+			if !files.FileExists(scenarioFile) {
+				t.Fatalf("example %s has no test configuration, add it to ExamplesOptions.Examples or ExamplesOptions.Skips, or add a %s file into its folder", example, scenarioFileName)
+			}
+			scenario, err := LoadScenario(scenarioFile)
+			require.NoError(t, err)
+			runScenario(t, scenario, moduleRootPath, exampleRelativePath)
+		})
+	}
+}
+
+func (o ExamplesOptions) checkUnknownExamples(examples []string) error {
+	discovered := make(map[string]bool)
+	for _, e := range examples {
+		discovered[e] = true
+	}
+	var unknown []string
+	for _, e := range append(sortedKeys(o.Examples), sortedKeys(o.Skips)...) {
+		if !discovered[e] {
+			unknown = append(unknown, e)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("configured examples not found: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// discoverExamples returns the relative paths of the folders that contain Terraform files, an example's sub-folders are not examples.
+func discoverExamples(examplesDir string) ([]string, error) {
+	var examples []string
+	err := filepath.WalkDir(examplesDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == examplesDir {
+			return nil
+		}
+		if isIgnoredFile(d.Name()) {
+			return filepath.SkipDir
+		}
+		isExample, err := containsTerraformFiles(path)
+		if err != nil {
+			return err
+		}
+		if !isExample {
+			return nil
+		}
+		rel, err := filepath.Rel(examplesDir, path)
+		if err != nil {
+			return err
+		}
+		examples = append(examples, filepath.ToSlash(rel))
+		return filepath.SkipDir
+	})
+	sort.Strings(examples)
+	return examples, err
+}
+
+func containsTerraformFiles(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && fileExt(entry.Name()) != "" && !isIgnoredFile(entry.Name()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
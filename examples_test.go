@@ -0,0 +1,66 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAllExamples(t *testing.T) {
+	RunAllExamples(t, "./", ExamplesOptions{
+		ExamplesFolder: "example",
+		Skips: map[string]string{
+			"after_upgrade":               "module used by upgrade test",
+			"breaking_change/after":       "module used by breaking change test",
+			"breaking_change/after_json":  "module used by breaking change test",
+			"breaking_change/before":      "module used by breaking change test",
+			"breaking_change/before_json": "module used by breaking change test",
+			"output_upgrade/after":        "module used by upgrade test",
+			"output_upgrade/before":       "module used by upgrade test",
+			"output_upgrade/test":         "example used by upgrade test",
+			"should_fail":                 "example that fails on purpose",
+			"upgrade":                     "example used by upgrade test",
+		},
+	})
+}
+
+func TestDiscoverExamples(t *testing.T) {
+	examplesDir := t.TempDir()
+	for path, content := range map[string]string{
+		"basic/main.tf":                 "",
+		"complete/main.tf":              "",
+		"complete/modules/vnet/main.tf": "",
+		"json/main.tf.json":             "{}",
+		"nested/multiple/main.tf":       "",
+		"nested/README.md":              "",
+		"no_terraform/README.md":        "",
+		".hidden/main.tf":               "",
+	} {
+		p := filepath.Join(examplesDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+	examples, err := discoverExamples(examplesDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"basic", "complete", "json", "nested/multiple"}, examples)
+}
+
+func TestExamplesOptions_unknownExamplesShouldFail(t *testing.T) {
+	opts := ExamplesOptions{
+		Examples: map[string]TestOptions{
+			"basic":   {},
+			"renamed": {},
+		},
+		Skips: map[string]string{
+			"deleted": "skip",
+		},
+	}
+	err := opts.checkUnknownExamples([]string{"basic", "complete"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "renamed")
+	assert.Contains(t, err.Error(), "deleted")
+	assert.NotContains(t, err.Error(), "basic")
+}
@@ -0,0 +1,75 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const fileLockRetryInterval = 100 * time.Millisecond
+
+// fileLock is a cross-process lock backed by an OS lock on a file, `flock` on Unix and `LockFileEx` on Windows, so the OS releases it when the owner dies.
+// The lock applies to each open of the file, goroutines in the same process exclude each other too. The file records the owner's hostname and pid for error messages,
+// it's kept after unlock, removing it would let a waiter lock a file that's no longer the lock.
+type fileLock struct {
+	path string
+	// timeout is how long Lock waits before giving up, zero means waiting forever.
+	timeout time.Duration
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: filepath.Clean(path)}
+}
+
+func (l *fileLock) Lock() (func(), error) {
+	start := time.Now()
+	for {
+		unlock, ok, err := l.tryLock()
+		if err != nil || ok {
+			return unlock, err
+		}
+		if l.timeout > 0 && time.Since(start) > l.timeout {
+			return nil, fmt.Errorf("timeout after %s waiting for lock %s, held by %s", l.timeout, l.path, l.owner())
+		}
+		time.Sleep(fileLockRetryInterval)
+	}
+}
+
+// tryLock returns false without waiting when the lock is held by others.
+func (l *fileLock) tryLock() (func(), bool, error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0750); err != nil {
+		return nil, false, err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := tryLockFile(f)
+	if err != nil || !ok {
+		_ = f.Close()
+		return nil, false, err
+	}
+	hostname, _ := os.Hostname()
+	if err = f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(fmt.Sprintf("%s\n%d\n", hostname, os.Getpid())), 0)
+	}
+	if err != nil {
+		_ = unlockFile(f)
+		_ = f.Close()
+		return nil, false, err
+	}
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+	}, true, nil
+}
+
+func (l *fileLock) owner() string {
+	content, err := os.ReadFile(l.path)
+	if err != nil || len(strings.TrimSpace(string(content))) == 0 {
+		return "unknown"
+	}
+	return strings.ReplaceAll(strings.TrimSpace(string(content)), "\n", " pid ")
+}
@@ -0,0 +1,17 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func tryLockFile(_ *os.File) (bool, error) {
+	return false, fmt.Errorf("cross-process file locks are not supported on %s", runtime.GOOS)
+}
+
+func unlockFile(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLock_mutualExclusion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "test.lock")
+	unlock, err := newFileLock(path).Lock()
+	require.NoError(t, err)
+	acquired := make(chan struct{})
+	go func() {
+		unlock2, err := newFileLock(path).Lock()
+		assert.NoError(t, err)
+		close(acquired)
+		unlock2()
+	}()
+	select {
+	case <-acquired:
+		assert.FailNow(t, "lock should be exclusive")
+	case <-time.After(300 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "lock should be acquired after release")
+	}
+}
+
+func TestFileLock_leftoverLockFileDoesNotBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("%s\n%d\n", hostname, deadPid)), 0600))
+	l := newFileLock(path)
+	l.timeout = time.Second
+	unlock, err := l.Lock()
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\n%d\n", hostname, os.Getpid()), string(content))
+	unlock()
+	assert.FileExists(t, path)
+}
+
+func TestFileLock_releasedWhenOwnerExits(t *testing.T) {
+	if os.Getenv("FILE_LOCK_TEST_OWNER") != "" {
+		_, err := newFileLock(os.Getenv("FILE_LOCK_TEST_OWNER")).Lock()
+		require.NoError(t, err)
+		os.Exit(0)
+	}
+	path := filepath.Join(t.TempDir(), "test.lock")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileLock_releasedWhenOwnerExits$")
+	cmd.Env = append(os.Environ(), "FILE_LOCK_TEST_OWNER="+path)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	l := newFileLock(path)
+	l.timeout = time.Second
+	unlock, err := l.Lock()
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestFileLock_timeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	unlock, err := newFileLock(path).Lock()
+	require.NoError(t, err)
+	defer unlock()
+	l := newFileLock(path)
+	l.timeout = 200 * time.Millisecond
+	_, err = l.Lock()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("pid %d", os.Getpid()))
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package terraform_module_test_helper
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockedRegion is a byte far beyond the owner record, Windows locks are mandatory, so locking the record would stop others from reading the owner.
+func lockedRegion() *windows.Overlapped {
+	return &windows.Overlapped{OffsetHigh: 0x40000000}
+}
+
+func tryLockFile(f *os.File) (bool, error) {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, lockedRegion())
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, lockedRegion())
+}
@@ -0,0 +1,128 @@
+package terraform_module_test_helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/gruntwork-io/terratest/modules/files"
+)
+
+const (
+	githubTagsCacheFolderName = "github-tags"
+	githubTagsPerPage         = 100
+)
+
+var githubTagsLocks = &KeyedMutex{}
+
+var githubTags = func(owner, repo string) ([]string, error) {
+	return cachedGithubTags(github.NewClient(githubClient()), owner, repo)
+}
+
+// githubTagsCache is the tag list of a repo saved on disk, page by page, along with each page's ETag.
+type githubTagsCache struct {
+	Pages []githubTagsPage `json:"pages"`
+}
+
+type githubTagsPage struct {
+	ETag     string   `json:"etag"`
+	Tags     []string `json:"tags"`
+	NextPage int      `json:"next_page"`
+}
+
+func (c githubTagsCache) tags() []string {
+	var tags []string
+	for _, p := range c.Pages {
+		tags = append(tags, p.Tags...)
+	}
+	return tags
+}
+
+// cachedGithubTags lists all tags of a repo once per run, tests in the same run, including other packages' processes, read the list fetched by the first one.
+// The list is kept on disk across runs, a new run requests every page with the page's cached ETag, a `304 Not Modified` reuses the cached page,
+// and doesn't count against the rate limit. Tags are ordered by name, not by time, so a new tag like a backport might land on any page.
+func cachedGithubTags(client *github.Client, owner, repo string) ([]string, error) {
+	key := hash(fmt.Sprintf("%s/%s/%s", client.BaseURL, owner, repo))
+	unlock, err := githubTagsLocks.LockE(key)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	cachePath := filepath.Join(os.TempDir(), "terraform-module-test-helper", githubTagsCacheFolderName, key+".json")
+	marker := filepath.Join(pluginCacheRunDir(), githubTagsCacheFolderName, key)
+	cache, cacheErr := readGithubTagsCache(cachePath)
+	if cacheErr == nil && files.FileExists(marker) {
+		return cache.tags(), nil
+	}
+	fetched, err := listGithubTags(client, owner, repo, cache)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeGithubTagsCache(cachePath, fetched); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(marker), 0750); err != nil {
+		return nil, err
+	}
+	return fetched.tags(), os.WriteFile(marker, []byte(cachePath), 0600)
+}
+
+// listGithubTags pages through all tags, a page that still matches its ETag in cached is taken from cached.
+func listGithubTags(client *github.Client, owner, repo string, cached githubTagsCache) (githubTagsCache, error) {
+	result := githubTagsCache{}
+	for page := 1; page != 0; {
+		req, err := client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/tags?per_page=%d&page=%d", owner, repo, githubTagsPerPage, page), nil)
+		if err != nil {
+			return result, err
+		}
+		var cachedPage *githubTagsPage
+		if page <= len(cached.Pages) && cached.Pages[page-1].ETag != "" {
+			cachedPage = &cached.Pages[page-1]
+			req.Header.Set("If-None-Match", cachedPage.ETag)
+		}
+		var tags []*github.RepositoryTag
+		resp, err := client.Do(context.TODO(), req, &tags)
+		if cachedPage != nil && resp != nil && resp.StatusCode == http.StatusNotModified {
+			result.Pages = append(result.Pages, *cachedPage)
+			page = cachedPage.NextPage
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		fetched := githubTagsPage{ETag: resp.Header.Get("ETag"), NextPage: resp.NextPage}
+		for _, tag := range tags {
+			if tag != nil {
+				fetched.Tags = append(fetched.Tags, tag.GetName())
+			}
+		}
+		result.Pages = append(result.Pages, fetched)
+		page = resp.NextPage
+	}
+	return result, nil
+}
+
+func readGithubTagsCache(path string) (githubTagsCache, error) {
+	var cache githubTagsCache
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return cache, err
+	}
+	err = json.Unmarshal(content, &cache)
+	return cache, err
+}
+
+func writeGithubTagsCache(path string, cache githubTagsCache) error {
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
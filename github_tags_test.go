@@ -0,0 +1,78 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedGithubTags(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	var requests, notModified int32
+	var page2 atomic.Value
+	page2.Store("v1.0.0")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body, etag := `[{"name": "v1.1.0"}]`, `"page1"`
+		if r.URL.Query().Get("page") == "2" {
+			tag := page2.Load().(string)
+			body, etag = fmt.Sprintf(`[{"name": "%s"}]`, tag), fmt.Sprintf(`"page2-%s"`, tag)
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/Azure/terraform-azurerm-aks/tags?per_page=100&page=2>; rel="next"`, server.URL))
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tags, err := cachedGithubTags(client, "Azure", "terraform-azurerm-aks")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"v1.1.0", "v1.0.0"}, tags)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), requests)
+
+	// a new run revalidates every cached page by its ETag
+	newRun := func() {
+		require.NoError(t, os.RemoveAll(filepath.Join(pluginCacheRunDir(), githubTagsCacheFolderName)))
+	}
+	newRun()
+	tags, err := cachedGithubTags(client, "Azure", "terraform-azurerm-aks")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0", "v1.0.0"}, tags)
+	assert.Equal(t, int32(4), requests)
+	assert.Equal(t, int32(2), notModified)
+
+	// a backport tag lands on a later page
+	page2.Store("v1.0.1")
+	newRun()
+	tags, err = cachedGithubTags(client, "Azure", "terraform-azurerm-aks")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0", "v1.0.1"}, tags)
+	assert.Equal(t, int32(6), requests)
+	assert.Equal(t, int32(3), notModified)
+}
@@ -0,0 +1,117 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// interruptGracePeriodEnv sets how long we wait for in-flight tests to destroy their resources after SIGINT or SIGTERM, default to 30 minutes.
+const interruptGracePeriodEnv = "TEST_INTERRUPT_GRACE_PERIOD"
+
+const defaultInterruptGracePeriod = 30 * time.Minute
+
+var coordinator = &interruptCoordinator{}
+
+var exit = os.Exit
+
+var interruptT = &standaloneT{name: "interrupt"}
+
+// interruptCoordinator handles SIGINT and SIGTERM, so in-flight tests could destroy their resources before the process exits.
+// After a signal, tests that haven't started are skipped, running tests fail at their next step so their deferred destroy runs,
+// and the process exits once all running tests finished or the grace period expired. A second signal exits immediately.
+// Workspaces that were not destroyed remain in the ledger for the janitor.
+type interruptCoordinator struct {
+	once        sync.Once
+	interrupted atomic.Bool
+	mu          sync.Mutex
+	running     map[int64]string
+	nextId      int64
+	signals     chan os.Signal
+}
+
+// start registers a running test and returns the function to call when the test finished, including destroy.
+func (c *interruptCoordinator) start(t testingT) func() {
+	c.once.Do(c.listen)
+	if c.interrupted.Load() {
+		t.T().Skip("test process is interrupted, skip new test")
+	}
+	c.mu.Lock()
+	c.nextId++
+	id := c.nextId
+	c.running[id] = t.Name()
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.running, id)
+	}
+}
+
+func (c *interruptCoordinator) listen() {
+	c.running = make(map[int64]string)
+	c.signals = make(chan os.Signal, 2)
+	signal.Notify(c.signals, os.Interrupt, syscall.SIGTERM)
+	go c.handle()
+}
+
+func (c *interruptCoordinator) handle() {
+	sig := <-c.signals
+	c.interrupted.Store(true)
+	gracePeriod := interruptGracePeriod()
+	serializedLogger.Logf(interruptT, "received %s, waiting at most %s for running tests to destroy their resources, send it again to exit immediately", sig, gracePeriod)
+	done := make(chan struct{})
+	go func() {
+		c.waitForRunningTests()
+		close(done)
+	}()
+	select {
+	case <-done:
+		serializedLogger.Logf(interruptT, "all running tests finished")
+	case <-time.After(gracePeriod):
+		c.logRunningTests(fmt.Sprintf("grace period %s expired", gracePeriod))
+	case <-c.signals:
+		c.logRunningTests("received signal again")
+	}
+	exit(1)
+}
+
+func (c *interruptCoordinator) waitForRunningTests() {
+	for {
+		c.mu.Lock()
+		n := len(c.running)
+		c.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (c *interruptCoordinator) logRunningTests(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range c.running {
+		serializedLogger.Logf(interruptT, "%s, resources created by %s might not be destroyed, run janitor to clean them", reason, name)
+	}
+}
+
+// failIfInterrupted fails the test so the deferred destroy could run, it's called between steps since we let the running terraform command finish.
+func (c *interruptCoordinator) failIfInterrupted(t testingT) {
+	if c.interrupted.Load() {
+		t.Fatalf("test process is interrupted, stop the test and destroy")
+	}
+}
+
+func interruptGracePeriod() time.Duration {
+	if v := os.Getenv(interruptGracePeriodEnv); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultInterruptGracePeriod
+}
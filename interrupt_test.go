@@ -0,0 +1,80 @@
+package terraform_module_test_helper
+
+import (
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterruptCoordinator_waitForRunningTestsThenExit(t *testing.T) {
+	exitCodes := make(chan int, 1)
+	stub := gostub.Stub(&exit, func(code int) {
+		exitCodes <- code
+	})
+	defer stub.Reset()
+	c := &interruptCoordinator{}
+	done := c.start(newT(t))
+	defer signal.Stop(c.signals)
+
+	c.signals <- syscall.SIGTERM
+	require.Eventually(t, c.interrupted.Load, time.Second, 10*time.Millisecond)
+	expectFailure(t, func(tt testingT) {
+		c.failIfInterrupted(tt)
+	})
+	select {
+	case <-exitCodes:
+		assert.FailNow(t, "should wait for running tests")
+	case <-time.After(100 * time.Millisecond):
+	}
+	done()
+	select {
+	case code := <-exitCodes:
+		assert.Equal(t, 1, code)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "should exit after running tests finished")
+	}
+}
+
+func TestInterruptCoordinator_exitAfterGracePeriod(t *testing.T) {
+	t.Setenv(interruptGracePeriodEnv, "10ms")
+	exitCodes := make(chan int, 1)
+	stub := gostub.Stub(&exit, func(code int) {
+		exitCodes <- code
+	})
+	defer stub.Reset()
+	c := &interruptCoordinator{}
+	done := c.start(newT(t))
+	defer done()
+	defer signal.Stop(c.signals)
+
+	c.signals <- syscall.SIGINT
+	select {
+	case code := <-exitCodes:
+		assert.Equal(t, 1, code)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "should exit after grace period")
+	}
+}
+
+func TestInterruptCoordinator_notInterrupted(t *testing.T) {
+	c := &interruptCoordinator{}
+	done := c.start(newT(t))
+	defer signal.Stop(c.signals)
+	defer done()
+	c.failIfInterrupted(newT(t))
+	assert.False(t, t.Failed())
+}
+
+func TestInterruptGracePeriod(t *testing.T) {
+	t.Setenv(interruptGracePeriodEnv, "")
+	assert.Equal(t, defaultInterruptGracePeriod, interruptGracePeriod())
+	t.Setenv(interruptGracePeriodEnv, "5m")
+	assert.Equal(t, 5*time.Minute, interruptGracePeriod())
+	t.Setenv(interruptGracePeriodEnv, "invalid")
+	assert.Equal(t, defaultInterruptGracePeriod, interruptGracePeriod())
+}
@@ -0,0 +1,81 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+const (
+	isolatedEnvFolder   = ".test-env"
+	tfDataDirEnv        = "TF_DATA_DIR"
+	tfCliConfigFileEnv  = "TF_CLI_CONFIG_FILE"
+	tfLogPathEnv        = "TF_LOG_PATH"
+	tfLogEnv            = "TF_LOG"
+	testTfLogEnv        = "TEST_TF_LOG"
+	defaultIsolatedLog  = "TRACE"
+	isolatedCliConfig   = "# Isolated Terraform CLI configuration for the test run, set TF_CLI_CONFIG_FILE in TerraformOptions.EnvVars to use your own.\n"
+	isolatedCliFileName = "terraform.rc"
+	isolatedLogFileName = "terraform.log"
+	isolatedDataDirName = "data"
+)
+
+// isolateEnv gives the run its own data dir, CLI configuration and log file in a folder inside its workspace, so they're removed or kept with the workspace.
+// Terraform only writes the log file when TF_LOG is set, its level is `TEST_TF_LOG`, or TF_LOG of the test process, default to TRACE.
+// The settings are passed through EnvVars, values set by the caller win.
+func isolateEnv(option terraform.Options) (terraform.Options, error) {
+	dir := filepath.Join(option.TerraformDir, isolatedEnvFolder)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return option, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, isolatedCliFileName), []byte(isolatedCliConfig), 0600); err != nil {
+		return option, err
+	}
+	envVars := isolatedEnvVars(option.TerraformDir)
+	for k, v := range option.EnvVars {
+		envVars[k] = v
+	}
+	option.EnvVars = envVars
+	return option, nil
+}
+
+func isolatedEnvVars(workspace string) map[string]string {
+	dir := filepath.Join(workspace, isolatedEnvFolder)
+	return map[string]string{
+		tfDataDirEnv:       filepath.Join(dir, isolatedDataDirName),
+		tfCliConfigFileEnv: filepath.Join(dir, isolatedCliFileName),
+		tfLogPathEnv:       filepath.Join(dir, isolatedLogFileName),
+		tfLogEnv:           isolatedLogLevel(),
+	}
+}
+
+func isolatedLogLevel() string {
+	if level := os.Getenv(testTfLogEnv); level != "" {
+		return level
+	}
+	if level := os.Getenv(tfLogEnv); level != "" {
+		return level
+	}
+	return defaultIsolatedLog
+}
+
+// relocateIsolatedEnv points the isolated settings to the workspace's new location after it was moved, settings set by the caller are kept.
+func relocateIsolatedEnv(option terraform.Options, oldWorkspace, newWorkspace string) terraform.Options {
+	if !files.IsExistingDir(filepath.Join(newWorkspace, isolatedEnvFolder)) {
+		return option
+	}
+	old := isolatedEnvVars(oldWorkspace)
+	envVars := make(map[string]string, len(option.EnvVars))
+	for k, v := range option.EnvVars {
+		envVars[k] = v
+	}
+	for k, v := range isolatedEnvVars(newWorkspace) {
+		if current, ok := envVars[k]; !ok || current == old[k] {
+			envVars[k] = v
+		}
+	}
+	option.EnvVars = envVars
+	return option
+}
@@ -0,0 +1,70 @@
+package terraform_module_test_helper
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsolateEnv(t *testing.T) {
+	dir := t.TempDir()
+	envVars := map[string]string{
+		"ARM_USE_MSI": "true",
+		tfLogPathEnv:  "/var/log/terraform.log",
+	}
+	option, err := isolateEnv(terraform.Options{TerraformDir: dir, EnvVars: envVars})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, isolatedEnvFolder, isolatedDataDirName), option.EnvVars[tfDataDirEnv])
+	assert.Equal(t, filepath.Join(dir, isolatedEnvFolder, isolatedCliFileName), option.EnvVars[tfCliConfigFileEnv])
+	assert.Equal(t, "/var/log/terraform.log", option.EnvVars[tfLogPathEnv], "caller's settings should win")
+	assert.Equal(t, "true", option.EnvVars["ARM_USE_MSI"])
+	assert.True(t, files.FileExists(option.EnvVars[tfCliConfigFileEnv]))
+	assert.Len(t, envVars, 2, "caller's EnvVars should not be modified")
+}
+
+func TestIsolateEnv_logLevel(t *testing.T) {
+	t.Setenv(tfLogEnv, "")
+	t.Setenv(testTfLogEnv, "")
+	assert.Equal(t, "TRACE", isolatedEnvVars(t.TempDir())[tfLogEnv])
+	t.Setenv(tfLogEnv, "INFO")
+	assert.Equal(t, "INFO", isolatedEnvVars(t.TempDir())[tfLogEnv])
+	t.Setenv(testTfLogEnv, "DEBUG")
+	assert.Equal(t, "DEBUG", isolatedEnvVars(t.TempDir())[tfLogEnv])
+	option, err := isolateEnv(terraform.Options{TerraformDir: t.TempDir(), EnvVars: map[string]string{tfLogEnv: "ERROR"}})
+	require.NoError(t, err)
+	assert.Equal(t, "ERROR", option.EnvVars[tfLogEnv], "caller's settings should win")
+}
+
+func TestRelocateIsolatedEnv(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	option, err := isolateEnv(terraform.Options{TerraformDir: oldDir, EnvVars: map[string]string{
+		tfLogPathEnv: "/var/log/terraform.log",
+	}})
+	require.NoError(t, err)
+	unmoved := relocateIsolatedEnv(option, oldDir, newDir)
+	assert.Equal(t, option.EnvVars, unmoved.EnvVars, "nothing to relocate when the folder wasn't moved")
+
+	_, err = isolateEnv(terraform.Options{TerraformDir: newDir})
+	require.NoError(t, err)
+	moved := relocateIsolatedEnv(option, oldDir, newDir)
+	assert.Equal(t, filepath.Join(newDir, isolatedEnvFolder, isolatedDataDirName), moved.EnvVars[tfDataDirEnv])
+	assert.Equal(t, filepath.Join(newDir, isolatedEnvFolder, isolatedCliFileName), moved.EnvVars[tfCliConfigFileEnv])
+	assert.Equal(t, "/var/log/terraform.log", moved.EnvVars[tfLogPathEnv])
+	assert.Equal(t, filepath.Join(oldDir, isolatedEnvFolder, isolatedDataDirName), option.EnvVars[tfDataDirEnv])
+}
+
+func TestDestroyCommand_withIsolatedEnv(t *testing.T) {
+	cmd := destroyCommand("/tmp/workspace", terraform.Options{
+		EnvVars: map[string]string{
+			tfDataDirEnv:        "/tmp/workspace/.test-env/data",
+			tfCliConfigFileEnv:  "/tmp/workspace/.test-env/terraform.rc",
+			"ARM_CLIENT_SECRET": "secret",
+		},
+	})
+	assert.Equal(t, "TF_DATA_DIR=/tmp/workspace/.test-env/data TF_CLI_CONFIG_FILE=/tmp/workspace/.test-env/terraform.rc terraform -chdir=/tmp/workspace destroy -auto-approve -input=false -lock=false", cmd)
+}
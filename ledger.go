@@ -0,0 +1,299 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/thanhpk/randstr"
+)
+
+// ledgerDirEnv overrides the folder of the workspace ledger, default to `terraform-module-test-helper/ledger` in the user's cache folder.
+const ledgerDirEnv = "TEST_WORKSPACE_LEDGER_DIR"
+
+// LedgerEntry records a workspace that might contain resources, so leaked resources can be destroyed by the janitor when the test process was killed.
+// Vars and var files are recorded since destroy needs them, environment variables are not recorded, the janitor uses its own environment.
+// The entry is plain JSON, so values of variables that are declared `sensitive` or named like secrets are not recorded, only their names in SecretVars,
+// the janitor reads them from `TF_VAR_<name>` in its environment.
+type LedgerEntry struct {
+	ID              string
+	Path            string
+	ModuleRoot      string
+	Example         string
+	TestName        string
+	StartTime       time.Time
+	StateFile       string
+	Hostname        string
+	Pid             int
+	Kept            bool
+	TerraformBinary string                 `json:",omitempty"`
+	Vars            map[string]interface{} `json:",omitempty"`
+	SecretVars      []string               `json:",omitempty"`
+	VarFiles        []string               `json:",omitempty"`
+}
+
+var secretVarName = regexp.MustCompile(`(?i)(password|secret|token|credential|private_key|access_key)`)
+
+// recordableVars splits vars into the values we can write to the ledger, and the names of the secrets we must not write.
+func recordableVars(terraformDir string, vars map[string]interface{}) (map[string]interface{}, []string) {
+	sensitive := make(map[string]bool)
+	if m, diag := tfconfig.LoadModule(terraformDir); !diag.HasErrors() {
+		for name, v := range m.Variables {
+			sensitive[name] = v.Sensitive
+		}
+	}
+	var recorded map[string]interface{}
+	var secrets []string
+	for _, name := range sortedKeys(vars) {
+		if sensitive[name] || secretVarName.MatchString(name) {
+			secrets = append(secrets, name)
+			continue
+		}
+		if recorded == nil {
+			recorded = make(map[string]interface{})
+		}
+		recorded[name] = vars[name]
+	}
+	return recorded, secrets
+}
+
+func ledgerDir() string {
+	if dir := os.Getenv(ledgerDirEnv); dir != "" {
+		return dir
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "terraform-module-test-helper", "ledger")
+}
+
+func registerWorkspace(t testingT, moduleRootPath, exampleRelativePath string, option terraform.Options) *LedgerEntry {
+	hostname, _ := os.Hostname()
+	entry := &LedgerEntry{
+		ID:              fmt.Sprintf("%s-%s", sanitizeName(t.Name()), randstr.Hex(8)),
+		Path:            option.TerraformDir,
+		ModuleRoot:      moduleRootPath,
+		Example:         exampleRelativePath,
+		TestName:        t.Name(),
+		StartTime:       time.Now(),
+		StateFile:       filepath.Join(option.TerraformDir, "terraform.tfstate"),
+		Hostname:        hostname,
+		Pid:             os.Getpid(),
+		TerraformBinary: option.TerraformBinary,
+		VarFiles:        option.VarFiles,
+	}
+	entry.Vars, entry.SecretVars = recordableVars(option.TerraformDir, option.Vars)
+	if err := entry.save(); err != nil {
+		logger.Log(t, fmt.Sprintf("cannot register workspace %s in ledger: %s", entry.Path, err.Error()))
+		return nil
+	}
+	return entry
+}
+
+func (e *LedgerEntry) path() string {
+	return filepath.Join(ledgerDir(), e.ID+".json")
+}
+
+func (e *LedgerEntry) save() error {
+	if err := os.MkdirAll(ledgerDir(), 0750); err != nil {
+		return err
+	}
+	c, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.path(), c, 0600)
+}
+
+// update records the options destroy needs after they changed, like a new Terraform binary or migration vars.
+func (e *LedgerEntry) update(option terraform.Options) error {
+	if e == nil {
+		return nil
+	}
+	e.TerraformBinary = option.TerraformBinary
+	e.Vars, e.SecretVars = recordableVars(e.Path, option.Vars)
+	e.VarFiles = option.VarFiles
+	return e.save()
+}
+
+// destroyTracked destroys the workspace, then removes its ledger entry. When destroy fails or resources remain, the entry is left,
+// so removeWorkspace keeps the workspace and the janitor can destroy it with its state.
+func destroyTracked(t testingT, option terraform.Options, verification DestroyVerification, entry *LedgerEntry) {
+	if destroy(t, option, verification) {
+		_ = entry.Remove()
+	}
+}
+
+// removeWorkspace removes the workspace unless a ledger entry of this process still tracks it, which means its resources might not be destroyed.
+func removeWorkspace(t terratest.TestingT, dir string) {
+	dir = filepath.Clean(dir)
+	entries, err := LedgerEntries()
+	if err != nil {
+		logger.Log(t, fmt.Sprintf("cannot read ledger: %s", err.Error()))
+	}
+	hostname, _ := os.Hostname()
+	for _, e := range entries {
+		if e.Hostname != hostname || e.Pid != os.Getpid() || e.Kept {
+			continue
+		}
+		if path := filepath.Clean(e.Path); path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			logger.Log(t, fmt.Sprintf("===> resources of workspace %s might not be destroyed, it's left to the janitor", e.Path))
+			return
+		}
+	}
+	_ = os.RemoveAll(dir)
+}
+
+// moveTo updates the entry after the workspace has been moved, eg: kept for debugging.
+func (e *LedgerEntry) moveTo(path string) error {
+	if e == nil {
+		return nil
+	}
+	e.Path = path
+	e.StateFile = filepath.Join(path, "terraform.tfstate")
+	e.Kept = true
+	return e.save()
+}
+
+func (e *LedgerEntry) Remove() error {
+	if e == nil {
+		return nil
+	}
+	err := os.Remove(e.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Stale returns true when the test process that registered the entry is gone, or the entry is older than maxAge.
+// Workspaces kept for debugging are stale only when they're older than maxAge.
+func (e *LedgerEntry) Stale(maxAge time.Duration) bool {
+	if maxAge > 0 && time.Since(e.StartTime) > maxAge {
+		return true
+	}
+	if e.Kept {
+		return false
+	}
+	hostname, _ := os.Hostname()
+	if e.Hostname != hostname {
+		return false
+	}
+	return !processAlive(e.Pid)
+}
+
+func LedgerEntries() ([]*LedgerEntry, error) {
+	dir := ledgerDir()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []*LedgerEntry
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		c, err := os.ReadFile(filepath.Clean(filepath.Join(dir, entry.Name())))
+		if err != nil {
+			return nil, err
+		}
+		e := &LedgerEntry{}
+		if err = json.Unmarshal(c, e); err != nil {
+			return nil, fmt.Errorf("invalid ledger entry %s: %s", entry.Name(), err.Error())
+		}
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result, nil
+}
+
+func StaleLedgerEntries(maxAge time.Duration) ([]*LedgerEntry, error) {
+	entries, err := LedgerEntries()
+	if err != nil {
+		return nil, err
+	}
+	var stale []*LedgerEntry
+	for _, e := range entries {
+		if e.Stale(maxAge) {
+			stale = append(stale, e)
+		}
+	}
+	return stale, nil
+}
+
+// Destroy destroys the resources in the entry's workspace with the same retry settings as the test's destroy, then prunes the entry.
+// An entry whose state file is gone has nothing we can destroy, so it's pruned too.
+func (e *LedgerEntry) Destroy() error {
+	if !files.FileExists(e.StateFile) {
+		return e.Remove()
+	}
+	for _, name := range e.SecretVars {
+		if _, ok := os.LookupEnv("TF_VAR_" + name); !ok {
+			return fmt.Errorf("cannot destroy %s: the value of variable %s is not recorded, set TF_VAR_%s", e.Path, name, name)
+		}
+	}
+	t := &standaloneT{name: e.ID}
+	option := terraform.Options{
+		TerraformBinary: e.TerraformBinary,
+		TerraformDir:    e.Path,
+		Vars:            e.Vars,
+		VarFiles:        e.VarFiles,
+		NoColor:         true,
+		Logger:          logger.Discard,
+	}
+	if files.IsExistingDir(filepath.Join(e.Path, isolatedEnvFolder)) {
+		option.EnvVars = isolatedEnvVars(e.Path)
+	}
+	if output, err := initE(t, &option); err != nil {
+		return fmt.Errorf("cannot init %s: %s\n%s", e.Path, err.Error(), output)
+	}
+	if err := destroyE(t, option); err != nil {
+		return fmt.Errorf("cannot destroy %s: %s", e.Path, err.Error())
+	}
+	return e.Remove()
+}
+
+var _ terratest.TestingT = &standaloneT{}
+
+// standaloneT lets terratest's functions run outside of go test.
+type standaloneT struct {
+	name string
+}
+
+func (j *standaloneT) Fail() {}
+
+func (j *standaloneT) FailNow() {
+	panic(fmt.Sprintf("%s: FailNow is not supported outside of go test", j.name))
+}
+
+func (j *standaloneT) Fatal(args ...interface{}) {
+	panic(fmt.Sprint(args...))
+}
+
+func (j *standaloneT) Fatalf(format string, args ...interface{}) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (j *standaloneT) Error(args ...interface{}) {}
+
+func (j *standaloneT) Errorf(format string, args ...interface{}) {}
+
+func (j *standaloneT) Name() string {
+	return j.name
+}
@@ -0,0 +1,156 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deadPid = 99999999
+
+func TestLedger_registerAndRemove(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	entry := registerWorkspace(newT(t), "./", "example/basic", terraform.Options{
+		TerraformDir: "/tmp/workspace/example/basic",
+		Vars: map[string]interface{}{
+			"location": "eastus",
+		},
+	})
+	require.NotNil(t, entry)
+	entries, err := LedgerEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "example/basic", entries[0].Example)
+	assert.Equal(t, filepath.Join("/tmp/workspace/example/basic", "terraform.tfstate"), entries[0].StateFile)
+	assert.Equal(t, "eastus", entries[0].Vars["location"])
+	assert.Equal(t, os.Getpid(), entries[0].Pid)
+	require.NoError(t, entry.Remove())
+	entries, err = LedgerEntries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLedger_secretVarsAreNotRecorded(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(`variable "admin" {
+  type      = string
+  sensitive = true
+}
+`), 0600))
+	entry := registerWorkspace(newT(t), "./", "example/basic", terraform.Options{
+		TerraformDir: dir,
+		Vars: map[string]interface{}{
+			"location":      "eastus",
+			"admin":         "p@ss",
+			"client_secret": "s3cret",
+		},
+	})
+	require.NotNil(t, entry)
+	content, err := os.ReadFile(entry.path())
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "p@ss")
+	assert.NotContains(t, string(content), "s3cret")
+	entries, err := LedgerEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{"location": "eastus"}, entries[0].Vars)
+	assert.Equal(t, []string{"admin", "client_secret"}, entries[0].SecretVars)
+
+	require.NoError(t, os.WriteFile(entries[0].StateFile, []byte("{}"), 0600))
+	err = entries[0].Destroy()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "set TF_VAR_admin")
+}
+
+func TestLedger_moveTo(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	entry := registerWorkspace(newT(t), "./", "example/basic", terraform.Options{TerraformDir: "/tmp/workspace"})
+	require.NotNil(t, entry)
+	require.NoError(t, entry.moveTo("/tmp/kept"))
+	entries, err := LedgerEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "/tmp/kept", entries[0].Path)
+	assert.True(t, entries[0].Kept)
+}
+
+func TestLedger_updateAndDestroyTracked(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	entry := registerWorkspace(newT(t), "./", "example/basic", terraform.Options{TerraformDir: t.TempDir(), TerraformBinary: "terraform"})
+	require.NotNil(t, entry)
+	require.NoError(t, entry.update(terraform.Options{TerraformBinary: "tofu", Vars: map[string]interface{}{"name": "migrated"}}))
+	entries, err := LedgerEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "tofu", entries[0].TerraformBinary)
+	assert.Equal(t, "migrated", entries[0].Vars["name"])
+	// no state file, nothing to destroy
+	destroyTracked(newT(t), terraform.Options{TerraformDir: entry.Path}, VerifyStateEmpty, entry)
+	entries, err = LedgerEntries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	var untracked *LedgerEntry
+	assert.NoError(t, untracked.update(terraform.Options{}))
+}
+
+func TestRemoveWorkspace_keepsWorkspaceTrackedByLedger(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	dir := t.TempDir()
+	example := filepath.Join(dir, "example", "basic")
+	require.NoError(t, os.MkdirAll(example, 0750))
+	entry := registerWorkspace(newT(t), "./", "example/basic", terraform.Options{TerraformDir: example})
+	require.NotNil(t, entry)
+	removeWorkspace(newT(t), dir)
+	assert.DirExists(t, example, "destroy didn't finish, the janitor needs the state")
+	require.NoError(t, entry.Remove())
+	removeWorkspace(newT(t), dir)
+	assert.NoDirExists(t, dir)
+}
+
+func TestLedgerEntry_stale(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	running := &LedgerEntry{Hostname: hostname, Pid: os.Getpid(), StartTime: time.Now()}
+	assert.False(t, running.Stale(0))
+	assert.False(t, running.Stale(time.Hour))
+	old := &LedgerEntry{Hostname: hostname, Pid: os.Getpid(), StartTime: time.Now().Add(-2 * time.Hour)}
+	assert.True(t, old.Stale(time.Hour))
+	dead := &LedgerEntry{Hostname: hostname, Pid: deadPid, StartTime: time.Now()}
+	assert.True(t, dead.Stale(0))
+	kept := &LedgerEntry{Hostname: hostname, Pid: deadPid, StartTime: time.Now(), Kept: true}
+	assert.False(t, kept.Stale(0))
+	otherHost := &LedgerEntry{Hostname: hostname + "-other", Pid: deadPid, StartTime: time.Now()}
+	assert.False(t, otherHost.Stale(0))
+}
+
+func TestStaleLedgerEntries(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	alive := &LedgerEntry{ID: "alive", Hostname: hostname, Pid: os.Getpid(), StartTime: time.Now()}
+	dead := &LedgerEntry{ID: "dead", Hostname: hostname, Pid: deadPid, StartTime: time.Now()}
+	require.NoError(t, alive.save())
+	require.NoError(t, dead.save())
+	stale, err := StaleLedgerEntries(0)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+	assert.Equal(t, "dead", stale[0].ID)
+}
+
+func TestLedgerEntry_destroyShouldPruneEntryWithoutState(t *testing.T) {
+	t.Setenv(ledgerDirEnv, t.TempDir())
+	entry := &LedgerEntry{ID: "no_state", Path: t.TempDir()}
+	entry.StateFile = filepath.Join(entry.Path, "terraform.tfstate")
+	require.NoError(t, entry.save())
+	require.NoError(t, entry.Destroy())
+	entries, err := LedgerEntries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,202 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+)
+
+type MajorUpgradeOptions struct {
+	// Policy picks the baselines within the previous major version, default to LatestWithinMajor.
+	Policy BaselinePolicy
+	// MigrationVars are merged into the options' Vars when planning against the new major version, like renamed or new required variables.
+	MigrationVars map[string]interface{}
+	// MigrationFiles are copied into the example before planning against the new major version, like a `moved.tf` with `moved` blocks.
+	MigrationFiles []string
+	// AllowedChanges are the only changes the migration plan may contain, no-op and read are always allowed.
+	AllowedChanges []AllowedChange
+	// ProtectedResourceTypes are resource types that must not be deleted or replaced even if AllowedChanges allows it, like `azurerm_storage_account`.
+	ProtectedResourceTypes []string
+	// SourceRedirects re-point the example's module blocks to the code under test besides the default `../..` and `../../modules/x`, like ModuleUpgradeOptions.SourceRedirects.
+	SourceRedirects []SourceRedirect
+}
+
+type AllowedChange struct {
+	// Address is a regular expression matched against resource addresses.
+	Address string
+	// Actions are the allowed actions, a change is allowed when all of its actions are listed, so a replacement needs both `delete` and `create`.
+	Actions []tfjson.Action
+}
+
+// ModuleMajorUpgradeTest tests the documented migration path from the previous major version to the current code.
+// It applies the baseline from the previous major version, re-points the module source to currentModulePath, adds MigrationFiles and MigrationVars,
+// then fails when the plan contains a change that AllowedChanges doesn't allow, or deletes a protected resource type.
+// At last the migration is applied, and the plan after it must be empty.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModuleMajorUpgradeTest(t *testing.T, source BaselineSource, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int, majorOpts MajorUpgradeOptions) {
+	tryParallel(newT(t))
+	previousMajorVer := currentMajorVer - 1
+	if previousMajorVer < 1 {
+		t.Skip(SkipV0Error.Error())
+	}
+	policy := majorOpts.Policy
+	if policy == nil {
+		policy = LatestWithinMajor{}
+	}
+	tags, err := selectBaselines(source, policy, previousMajorVer)
+	if err == CannotTestError {
+		t.Skip(err.Error())
+	}
+	require.NoError(t, err)
+	forEachBaseline(t, tags, func(t *testing.T, tag string) {
+		runModuleUpgradeTest(t, source, moduleFolderRelativeToRoot, opts, func(t *T, opts terraform.Options) error {
+			return majorUpgrade(t, source, tag, moduleFolderRelativeToRoot, currentModulePath, opts, majorOpts)
+		})
+	})
+}
+
+func majorUpgrade(t *T, source BaselineSource, tag, moduleFolderRelativeToRoot, newModulePath string, opts terraform.Options, majorOpts MajorUpgradeOptions) error {
+	report := newUpgradeReport(t, "major", moduleFolderRelativeToRoot, tag)
+	return report.save(t, newModulePath, migrateMajorVersion(t, source, tag, moduleFolderRelativeToRoot, newModulePath, opts, majorOpts, report))
+}
+
+func migrateMajorVersion(t *T, source BaselineSource, tag, moduleFolderRelativeToRoot, newModulePath string, opts terraform.Options, majorOpts MajorUpgradeOptions, report *UpgradeReport) error {
+	tmpDirForTag, cleanup, err := source.Checkout(tag)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if !files.FileExists(filepath.Join(tmpDirForTag, moduleFolderRelativeToRoot)) {
+		return CannotTestError
+	}
+	tmpTestDir := test_structure.CopyTerraformFolderToTemp(t, tmpDirForTag, moduleFolderRelativeToRoot)
+	defer func() {
+		removeWorkspace(t, tmpTestDir)
+	}()
+	opts.TerraformDir = tmpTestDir
+	if err = renderTemplates(t, opts); err != nil {
+		return err
+	}
+	opts, err = isolateEnv(opts)
+	if err != nil {
+		return err
+	}
+	entry := registerWorkspace(t, source.String(), moduleFolderRelativeToRoot, opts)
+	defer func() {
+		// once migrated, destroy needs the migration vars
+		destroyTracked(t, opts, VerifyStateEmpty, entry)
+	}()
+	initAndApply(t, &opts)
+	coordinator.failIfInterrupted(t)
+
+	overrideModuleSourceToCurrentPath(t, tmpTestDir, majorOpts.SourceRedirects, newModulePath)
+	for _, f := range majorOpts.MigrationFiles {
+		if err = copyFile(f, filepath.Join(tmpTestDir, filepath.Base(f))); err != nil {
+			return err
+		}
+	}
+	opts.Vars = mergeVars(opts.Vars, majorOpts.MigrationVars)
+	if err = entry.update(opts); err != nil {
+		return err
+	}
+	planOpts := opts
+	planOpts.Logger = logger.Discard
+	plan, reasons := initAndPlanWithActionReasons(t, planOpts)
+	violations, err := disallowedChanges(plan.ResourceChangesMap, majorOpts.AllowedChanges, majorOpts.ProtectedResourceTypes)
+	if err != nil {
+		return err
+	}
+	report.addHop(tag, currentCodeHop, migrationVerdict(plan.ResourceChangesMap, reasons, violations))
+	if len(violations) > 0 {
+		return fmt.Errorf("major upgrade from %s contains disallowed changes:\n%s", tag, strings.Join(violations, "\n"))
+	}
+	initAndApply(t, &opts)
+	coordinator.failIfInterrupted(t)
+	if _, err = initAndPlanAndIdempotentAtEasyMode(t, opts, ChangePolicy{}); err != nil {
+		return fmt.Errorf("major upgrade from %s doesn't converge after migration: %w", tag, err)
+	}
+	return nil
+}
+
+// migrationVerdict classifies the migration plan's changes, a change is allowed unless it's one of the violations.
+func migrationVerdict(changes map[string]*tfjson.ResourceChange, reasons map[string]string, violations []string) ChangeVerdict {
+	verdict, _ := ChangePolicy{}.verdict(changes, reasons)
+	verdict.Passed = true
+	for i, c := range verdict.Changes {
+		disallowed := linq.From(violations).AnyWith(func(v interface{}) bool {
+			return strings.HasPrefix(v.(string), fmt.Sprintf("  %s: ", c.Address))
+		})
+		verdict.Changes[i].Allowed = !disallowed
+		verdict.Passed = verdict.Passed && !disallowed
+	}
+	return verdict
+}
+
+// disallowedChanges lists the changes that no AllowedChange allows, and deletions of protected resource types, sorted by address.
+func disallowedChanges(changes map[string]*tfjson.ResourceChange, allowed []AllowedChange, protectedTypes []string) ([]string, error) {
+	var regexes []*regexp.Regexp
+	for _, a := range allowed {
+		r, err := regexp.Compile(a.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed change address pattern %s: %s", a.Address, err.Error())
+		}
+		regexes = append(regexes, r)
+	}
+	var violations []string
+	for _, address := range sortedKeys(changes) {
+		change := changes[address]
+		actions := changeActions(change)
+		if actions == "" || change.Change.Actions.Read() {
+			continue
+		}
+		if change.Change.Actions.Delete() || change.Change.Actions.Replace() {
+			if linq.From(protectedTypes).Contains(change.Type) {
+				violations = append(violations, fmt.Sprintf("  %s: %s (%s is protected)", address, actions, change.Type))
+				continue
+			}
+		}
+		isAllowed := false
+		for i, a := range allowed {
+			if regexes[i].MatchString(address) && allActionsIn(change.Change.Actions, a.Actions) {
+				isAllowed = true
+				break
+			}
+		}
+		if !isAllowed {
+			violations = append(violations, fmt.Sprintf("  %s: %s", address, actions))
+		}
+	}
+	return violations, nil
+}
+
+func allActionsIn(actions tfjson.Actions, allowed []tfjson.Action) bool {
+	return linq.From(actions).All(func(i interface{}) bool {
+		return linq.From(allowed).Contains(i)
+	})
+}
+
+// mergeVars returns a copy of vars with overrides applied.
+func mergeVars(vars, overrides map[string]interface{}) map[string]interface{} {
+	if len(overrides) == 0 {
+		return vars
+	}
+	merged := make(map[string]interface{}, len(vars)+len(overrides))
+	for k, v := range vars {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
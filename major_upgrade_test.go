@@ -0,0 +1,83 @@
+package terraform_module_test_helper
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisallowedChanges(t *testing.T) {
+	change := func(resourceType string, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{
+			Type:   resourceType,
+			Change: &tfjson.Change{Actions: actions},
+		}
+	}
+	changes := map[string]*tfjson.ResourceChange{
+		"module.aks.azurerm_kubernetes_cluster.main":      change("azurerm_kubernetes_cluster", tfjson.ActionUpdate),
+		"module.aks.azurerm_log_analytics_workspace.main": change("azurerm_log_analytics_workspace", tfjson.ActionDelete, tfjson.ActionCreate),
+		"module.aks.azurerm_storage_account.main":         change("azurerm_storage_account", tfjson.ActionDelete),
+		"module.aks.azurerm_role_assignment.acr":          change("azurerm_role_assignment", tfjson.ActionDelete, tfjson.ActionCreate),
+		"module.aks.azurerm_subnet.main":                  change("azurerm_subnet", tfjson.ActionNoop),
+		"data.azurerm_client_config.current":              change("azurerm_client_config", tfjson.ActionRead),
+	}
+	violations, err := disallowedChanges(changes, []AllowedChange{
+		{
+			Address: `azurerm_kubernetes_cluster\.main$`,
+			Actions: []tfjson.Action{tfjson.ActionUpdate},
+		},
+		{
+			Address: `azurerm_role_assignment`,
+			Actions: []tfjson.Action{tfjson.ActionUpdate},
+		},
+		{
+			Address: `.*`,
+			Actions: []tfjson.Action{tfjson.ActionDelete, tfjson.ActionCreate},
+		},
+	}, []string{"azurerm_storage_account"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"  module.aks.azurerm_storage_account.main: delete (azurerm_storage_account is protected)",
+	}, violations)
+
+	violations, err = disallowedChanges(changes, []AllowedChange{
+		{
+			Address: `azurerm_kubernetes_cluster\.main$`,
+			Actions: []tfjson.Action{tfjson.ActionUpdate},
+		},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"  module.aks.azurerm_log_analytics_workspace.main: delete, create",
+		"  module.aks.azurerm_role_assignment.acr: delete, create",
+		"  module.aks.azurerm_storage_account.main: delete",
+	}, violations)
+
+	_, err = disallowedChanges(changes, []AllowedChange{{Address: "("}}, nil)
+	assert.Error(t, err)
+}
+
+func TestMergeVars(t *testing.T) {
+	vars := map[string]interface{}{"location": "eastus", "sku": "Free"}
+	merged := mergeVars(vars, map[string]interface{}{"sku": "Standard", "rbac_aad": true})
+	assert.Equal(t, map[string]interface{}{"location": "eastus", "sku": "Standard", "rbac_aad": true}, merged)
+	assert.Equal(t, "Free", vars["sku"])
+}
+
+func TestMigrationVerdict(t *testing.T) {
+	changes := map[string]*tfjson.ResourceChange{
+		"module.aks.azurerm_kubernetes_cluster.main": {Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+		"module.aks.azurerm_storage_account.main":    {Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}}},
+	}
+	verdict := migrationVerdict(changes, map[string]string{"module.aks.azurerm_storage_account.main": "delete_because_no_resource_config"},
+		[]string{"  module.aks.azurerm_storage_account.main: delete (azurerm_storage_account is protected)"})
+	assert.False(t, verdict.Passed)
+	require.Len(t, verdict.Changes, 2)
+	assert.True(t, verdict.Changes[0].Allowed)
+	assert.False(t, verdict.Changes[1].Allowed)
+	assert.Equal(t, "delete_because_no_resource_config", verdict.Changes[1].ActionReason)
+
+	assert.True(t, migrationVerdict(changes, nil, nil).Passed)
+}
@@ -0,0 +1,103 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/require"
+)
+
+const terraformInstallDirEnv = "TERRAFORM_INSTALL_DIR"
+
+// RunE2ETestMatrix runs the same example once per binary as parallel subtests, by setting TerraformOptions.TerraformBinary.
+// A binary is a path, or a version or name installed in `TERRAFORM_INSTALL_DIR`, like `1.5.7` or `tofu-1.6.2`, or a binary on PATH like `tofu`.
+// All results, with the binary and its version, are recorded in the example's TestRecord once all subtests finished.
+func RunE2ETestMatrix(t *testing.T, moduleRootPath, exampleRelativePath string, binaries []string, testOption TestOptions) {
+	require.NotEmpty(t, binaries, "binary matrix is empty")
+	record := &matrixRecord{}
+	t.Cleanup(func() {
+		require.NoError(t, record.save(t))
+	})
+	for i, b := range binaries {
+		index, spec := i, b
+		t.Run(sanitizeName(spec), func(t *testing.T) {
+			binary, err := resolveTerraformBinary(spec)
+			require.NoError(t, err)
+			option := testOption
+			option.TerraformOptions.TerraformBinary = binary
+			initAndApplyAndIdempotentTest(newT(t), moduleRootPath, exampleRelativePath, option, e2eTestExecutor{matrix: record, matrixIndex: index})
+		})
+	}
+}
+
+// resolveTerraformBinary finds a binary by path, then in the install directory, then on PATH.
+// The install directory could be laid out like tfenv (`<version>/terraform`), or tfswitch (`terraform_<version>`).
+func resolveTerraformBinary(spec string) (string, error) {
+	if strings.ContainsAny(spec, `/\`) {
+		if isFile(spec) {
+			return filepath.Abs(spec)
+		}
+		return "", fmt.Errorf("terraform binary %s not found", spec)
+	}
+	var candidates []string
+	if dir := os.Getenv(terraformInstallDirEnv); dir != "" {
+		candidates = []string{
+			filepath.Join(dir, spec),
+			filepath.Join(dir, spec, "terraform"),
+			filepath.Join(dir, spec, "tofu"),
+			filepath.Join(dir, "terraform_"+spec),
+			filepath.Join(dir, "tofu_"+spec),
+		}
+	}
+	for _, candidate := range candidates {
+		if isFile(candidate) {
+			return candidate, nil
+		}
+	}
+	if path, err := exec.LookPath(spec); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("terraform binary %s not found in %s (%s) or on PATH, tried:\n%s", spec, terraformInstallDirEnv, os.Getenv(terraformInstallDirEnv), strings.Join(candidates, "\n"))
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// matrixRecord collects snapshots from a matrix's subtests, and saves them in the matrix's order.
+type matrixRecord struct {
+	mu        sync.Mutex
+	snapshots map[int]*TestVersionSnapshot
+}
+
+func (r *matrixRecord) add(index int, s *TestVersionSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.snapshots == nil {
+		r.snapshots = make(map[int]*TestVersionSnapshot)
+	}
+	r.snapshots[index] = s
+}
+
+func (r *matrixRecord) save(t terratest.TestingT) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	indexes := make([]int, 0, len(r.snapshots))
+	for i := range r.snapshots {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	var snapshots []*TestVersionSnapshot
+	for _, i := range indexes {
+		snapshots = append(snapshots, r.snapshots[i])
+	}
+	return saveSnapshots(t, snapshots)
+}
@@ -0,0 +1,75 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTerraformBinary(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(terraformInstallDirEnv, dir)
+	tfenvStyle := filepath.Join(dir, "1.5.7", "terraform")
+	tofu := filepath.Join(dir, "tofu-1.6.2", "tofu")
+	tfswitchStyle := filepath.Join(dir, "terraform_1.3.9")
+	for _, binary := range []string{tfenvStyle, tofu, tfswitchStyle} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(binary), 0750))
+		require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\n"), 0600))
+	}
+	cases := map[string]string{
+		"1.5.7":      tfenvStyle,
+		"tofu-1.6.2": tofu,
+		"1.3.9":      tfswitchStyle,
+		tofu:         tofu,
+	}
+	for spec, expected := range cases {
+		binary, err := resolveTerraformBinary(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, expected, binary, spec)
+	}
+	_, err := resolveTerraformBinary("1.0.0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(dir, "1.0.0", "terraform"))
+	_, err = resolveTerraformBinary(filepath.Join(dir, "1.0.0", "terraform"))
+	require.Error(t, err)
+}
+
+func TestMatrixRecord_saveInMatrixOrder(t *testing.T) {
+	defer func() {
+		_ = os.RemoveAll("TestRecord")
+	}()
+	localPath := filepath.Join("example", "basic", "TestRecord.md.tmp")
+	defer func() { _ = os.Remove(localPath) }()
+	stub := gostub.Stub(&initE, func(terratest.TestingT, *terraform.Options) (string, error) {
+		return "", nil
+	})
+	defer stub.Reset()
+	stub.Stub(&runTerraformCommandE, func(_ terratest.TestingT, options *terraform.Options, _ ...string) (string, error) {
+		return "version of " + options.TerraformBinary, nil
+	})
+	record := &matrixRecord{}
+	second := FailedTestVersionSnapshot(".", filepath.Join("example", "basic"), "apply failed")
+	second.TerraformBinary = "/opt/tofu"
+	first := SuccessTestVersionSnapshot(".", filepath.Join("example", "basic"))
+	first.TerraformBinary = "/opt/terraform"
+	record.add(1, second)
+	record.add(0, first)
+	require.NoError(t, record.save(t))
+	content, err := os.ReadFile(filepath.Clean(localPath))
+	require.NoError(t, err)
+	record1 := strings.Index(string(content), "### Terraform Binary\n\n/opt/terraform\n")
+	record2 := strings.Index(string(content), "### Terraform Binary\n\n/opt/tofu\n")
+	require.NotEqual(t, -1, record1)
+	require.NotEqual(t, -1, record2)
+	assert.Less(t, record1, record2)
+	assert.Contains(t, string(content), "version of /opt/terraform")
+	assert.Contains(t, string(content), "version of /opt/tofu")
+	assert.Contains(t, string(content), "apply failed")
+}
@@ -0,0 +1,372 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	providerFilesystemMirrorEnv   = "TEST_PROVIDER_FILESYSTEM_MIRROR"
+	providerNetworkMirrorEnv      = "TEST_PROVIDER_NETWORK_MIRROR"
+	defaultProviderRegistryHost   = "registry.terraform.io"
+	minProviderVersionsOverride   = "min_provider_versions_override.tf"
+	minProviderVersionsCliConfig  = "min_provider_versions.tfrc"
+	terraformLockFileName         = ".terraform.lock.hcl"
+	packedProviderFileNamePattern = `^terraform-provider-%s_(.+)_%s_%s\.zip$`
+	registryRequestTimeout        = time.Minute
+)
+
+// registryClient gives up a registry or mirror request after registryRequestTimeout, so an unresponsive registry fails the test instead of hanging it.
+var registryClient = &http.Client{Timeout: registryRequestTimeout}
+
+type MinProviderVersionOptions struct {
+	TestOptions TestOptions
+	// FilesystemMirror is a folder in the layout of `terraform providers mirror`, default to `TEST_PROVIDER_FILESYSTEM_MIRROR`.
+	FilesystemMirror string
+	// NetworkMirror is the base URL of a provider network mirror, default to `TEST_PROVIDER_NETWORK_MIRROR`.
+	// When neither mirror is set, versions are resolved from and installed by the provider's origin registry.
+	NetworkMirror string
+}
+
+// RunMinProviderVersionTest runs the example with the lowest provider versions allowed by the `required_providers` of both the module and the example.
+// Only providers with a lower bound, like `>= 3.40` or `~> 3.40`, are pinned. Versions are resolved from the configured mirror,
+// which is also the only installation source, so the test works offline with a filesystem mirror.
+func RunMinProviderVersionTest(t *testing.T, moduleRootPath, exampleRelativePath string, opts MinProviderVersionOptions) {
+	opts = opts.withDefaults()
+	requirements, err := providerRequirements(moduleRootPath, filepath.Join(moduleRootPath, exampleRelativePath))
+	require.NoError(t, err)
+	source := opts.versionSource()
+	pins := make(map[string]providerPin)
+	for _, name := range sortedKeys(requirements) {
+		r := requirements[name]
+		if !r.hasLowerBound() {
+			logger.Log(t, fmt.Sprintf("===> provider %s has no lower bound in %s, not pinned", r.address, strings.Join(r.constraints, ", ")))
+			continue
+		}
+		v, err := r.lowestVersion(source)
+		require.NoError(t, err)
+		logger.Log(t, fmt.Sprintf("===> pin provider %s to %s, the lowest version allowed by %s", r.address, v, strings.Join(r.constraints, ", ")))
+		pins[name] = providerPin{source: r.address.source(), version: v.String()}
+	}
+	testOption := opts.TestOptions
+	testOption.TerraformOptions.Upgrade = false
+	if cliConfig := opts.cliConfig(); cliConfig != "" {
+		path := filepath.Join(t.TempDir(), minProviderVersionsCliConfig)
+		require.NoError(t, os.WriteFile(path, []byte(cliConfig), 0600))
+		envVars := map[string]string{tfCliConfigFileEnv: path}
+		for k, v := range testOption.TerraformOptions.EnvVars {
+			envVars[k] = v
+		}
+		testOption.TerraformOptions.EnvVars = envVars
+	}
+	prepare := testOption.prepareWorkspace
+	testOption.prepareWorkspace = func(dir string) error {
+		if prepare != nil {
+			if err := prepare(dir); err != nil {
+				return err
+			}
+		}
+		return pinProviderVersions(dir, pins)
+	}
+	RunE2ETestWithOption(t, moduleRootPath, exampleRelativePath, testOption)
+}
+
+func (o MinProviderVersionOptions) withDefaults() MinProviderVersionOptions {
+	if o.FilesystemMirror == "" {
+		o.FilesystemMirror = os.Getenv(providerFilesystemMirrorEnv)
+	}
+	if o.NetworkMirror == "" {
+		o.NetworkMirror = os.Getenv(providerNetworkMirrorEnv)
+	}
+	if o.NetworkMirror != "" && !strings.HasSuffix(o.NetworkMirror, "/") {
+		o.NetworkMirror += "/"
+	}
+	return o
+}
+
+func (o MinProviderVersionOptions) versionSource() providerVersionSource {
+	if o.FilesystemMirror != "" {
+		return filesystemMirror(o.FilesystemMirror)
+	}
+	if o.NetworkMirror != "" {
+		return networkMirror(o.NetworkMirror)
+	}
+	return originRegistry{}
+}
+
+// cliConfig makes the mirror the only installation source, so versions we resolved are the versions that would be installed.
+func (o MinProviderVersionOptions) cliConfig() string {
+	if o.FilesystemMirror != "" {
+		abs, err := filepath.Abs(o.FilesystemMirror)
+		if err != nil {
+			abs = o.FilesystemMirror
+		}
+		return fmt.Sprintf("provider_installation {\n  filesystem_mirror {\n    path = %q\n  }\n}\n", filepath.ToSlash(abs))
+	}
+	if o.NetworkMirror != "" {
+		return fmt.Sprintf("provider_installation {\n  network_mirror {\n    url = %q\n  }\n}\n", o.NetworkMirror)
+	}
+	return ""
+}
+
+type providerAddress struct {
+	hostname  string
+	namespace string
+	name      string
+}
+
+// parseProviderSource parses a source address like `azure/azapi`, `registry.terraform.io/hashicorp/azurerm`, a provider without source is a `hashicorp` provider.
+func parseProviderSource(localName, source string) (providerAddress, error) {
+	if source == "" {
+		return providerAddress{hostname: defaultProviderRegistryHost, namespace: "hashicorp", name: localName}, nil
+	}
+	segments := strings.Split(strings.ToLower(source), "/")
+	switch len(segments) {
+	case 2:
+		return providerAddress{hostname: defaultProviderRegistryHost, namespace: segments[0], name: segments[1]}, nil
+	case 3:
+		return providerAddress{hostname: segments[0], namespace: segments[1], name: segments[2]}, nil
+	}
+	return providerAddress{}, fmt.Errorf("invalid provider source %q", source)
+}
+
+func (a providerAddress) source() string {
+	return fmt.Sprintf("%s/%s/%s", a.hostname, a.namespace, a.name)
+}
+
+func (a providerAddress) String() string {
+	return a.source()
+}
+
+type providerRequirement struct {
+	address     providerAddress
+	constraints []string
+}
+
+// providerRequirements merges the `required_providers` of the given folders by source address, keyed by the local name in the last folder that declares the provider.
+func providerRequirements(dirs ...string) (map[string]*providerRequirement, error) {
+	bySource := make(map[string]*providerRequirement)
+	localNames := make(map[string]string)
+	for _, dir := range dirs {
+		m, diag := tfconfig.LoadModule(dir)
+		if diag.HasErrors() {
+			return nil, diag
+		}
+		for localName, r := range m.RequiredProviders {
+			address, err := parseProviderSource(localName, r.Source)
+			if err != nil {
+				return nil, err
+			}
+			requirement, ok := bySource[address.source()]
+			if !ok {
+				requirement = &providerRequirement{address: address}
+				bySource[address.source()] = requirement
+			}
+			requirement.constraints = append(requirement.constraints, r.VersionConstraints...)
+			localNames[address.source()] = localName
+		}
+	}
+	result := make(map[string]*providerRequirement)
+	for source, r := range bySource {
+		result[localNames[source]] = r
+	}
+	return result, nil
+}
+
+var lowerBoundOperator = regexp.MustCompile(`^\s*(>=|>|~>|=|v?\d)`)
+
+func (r *providerRequirement) hasLowerBound() bool {
+	for _, c := range r.constraints {
+		for _, part := range strings.Split(c, ",") {
+			if lowerBoundOperator.MatchString(part) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lowestVersion returns the lowest non-prerelease version in the source that satisfies all constraints.
+func (r *providerRequirement) lowestVersion(source providerVersionSource) (*version.Version, error) {
+	var constraints version.Constraints
+	for _, c := range r.constraints {
+		parsed, err := version.NewConstraint(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q of provider %s: %w", c, r.address, err)
+		}
+		constraints = append(constraints, parsed...)
+	}
+	versions, err := source.versions(r.address)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(version.Collection(versions))
+	for _, v := range versions {
+		if v.Prerelease() == "" && constraints.Check(v) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("no version of provider %s in %s satisfies %s", r.address, source, strings.Join(r.constraints, ", "))
+}
+
+type providerPin struct {
+	source  string
+	version string
+}
+
+// pinProviderVersions writes an override file pinning the providers, and removes the lock file that might lock newer versions.
+func pinProviderVersions(dir string, pins map[string]providerPin) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(dir, terraformLockFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	sb := strings.Builder{}
+	sb.WriteString("terraform {\n  required_providers {\n")
+	for _, name := range sortedKeys(pins) {
+		pin := pins[name]
+		sb.WriteString(fmt.Sprintf("    %s = {\n      source  = %q\n      version = %q\n    }\n", name, pin.source, pin.version))
+	}
+	sb.WriteString("  }\n}\n")
+	return os.WriteFile(filepath.Join(dir, minProviderVersionsOverride), []byte(sb.String()), 0600)
+}
+
+type providerVersionSource interface {
+	versions(address providerAddress) ([]*version.Version, error)
+	String() string
+}
+
+// filesystemMirror reads versions for the current platform from a folder in the packed or unpacked layout of `terraform providers mirror`.
+type filesystemMirror string
+
+func (m filesystemMirror) versions(address providerAddress) ([]*version.Version, error) {
+	dir := filepath.Join(string(m), address.hostname, address.namespace, address.name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read provider %s from filesystem mirror %s: %w", address, m, err)
+	}
+	packed := regexp.MustCompile(fmt.Sprintf(packedProviderFileNamePattern, regexp.QuoteMeta(address.name), runtime.GOOS, runtime.GOARCH))
+	var versions []*version.Version
+	for _, entry := range entries {
+		raw := ""
+		if entry.IsDir() && files.IsExistingDir(filepath.Join(dir, entry.Name(), fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH))) {
+			raw = entry.Name()
+		} else if matches := packed.FindStringSubmatch(entry.Name()); matches != nil {
+			raw = matches[1]
+		}
+		if raw == "" {
+			continue
+		}
+		if v, err := version.NewVersion(raw); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (m filesystemMirror) String() string {
+	return fmt.Sprintf("filesystem mirror %s", string(m))
+}
+
+// networkMirror reads versions from the provider network mirror protocol's `index.json`.
+type networkMirror string
+
+func (m networkMirror) versions(address providerAddress) ([]*version.Version, error) {
+	u, err := url.JoinPath(string(m), address.hostname, address.namespace, address.name, "index.json")
+	if err != nil {
+		return nil, err
+	}
+	var index struct {
+		Versions map[string]json.RawMessage `json:"versions"`
+	}
+	if err = getJson(u, &index); err != nil {
+		return nil, err
+	}
+	return parseVersions(sortedKeys(index.Versions)), nil
+}
+
+func (m networkMirror) String() string {
+	return fmt.Sprintf("network mirror %s", string(m))
+}
+
+// originRegistry reads versions for the current platform from the provider registry protocol of the provider's hostname.
+type originRegistry struct {
+	// baseUrl overrides `https://<hostname>`, for tests.
+	baseUrl string
+}
+
+func (r originRegistry) versions(address providerAddress) ([]*version.Version, error) {
+	base := r.baseUrl
+	if base == "" {
+		base = fmt.Sprintf("https://%s", address.hostname)
+	}
+	u, err := url.JoinPath(base, "v1", "providers", address.namespace, address.name, "versions")
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Versions []struct {
+			Version   string `json:"version"`
+			Platforms []struct {
+				Os   string `json:"os"`
+				Arch string `json:"arch"`
+			} `json:"platforms"`
+		} `json:"versions"`
+	}
+	if err = getJson(u, &response); err != nil {
+		return nil, err
+	}
+	var raws []string
+	for _, v := range response.Versions {
+		for _, p := range v.Platforms {
+			if p.Os == runtime.GOOS && p.Arch == runtime.GOARCH {
+				raws = append(raws, v.Version)
+				break
+			}
+		}
+	}
+	return parseVersions(raws), nil
+}
+
+func (r originRegistry) String() string {
+	return "origin registry"
+}
+
+func getJson(u string, v any) error {
+	resp, err := registryClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func parseVersions(raws []string) []*version.Version {
+	var versions []*version.Version
+	for _, raw := range raws {
+		if v, err := version.NewVersion(raw); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
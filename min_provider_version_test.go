@@ -0,0 +1,174 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProviderSource(t *testing.T) {
+	cases := map[string]providerAddress{
+		"":                                       {hostname: defaultProviderRegistryHost, namespace: "hashicorp", name: "azurerm"},
+		"hashicorp/azurerm":                      {hostname: defaultProviderRegistryHost, namespace: "hashicorp", name: "azurerm"},
+		"Azure/AzAPI":                            {hostname: defaultProviderRegistryHost, namespace: "azure", name: "azapi"},
+		"registry.opentofu.org/hashicorp/random": {hostname: "registry.opentofu.org", namespace: "hashicorp", name: "random"},
+	}
+	for source, expected := range cases {
+		address, err := parseProviderSource("azurerm", source)
+		require.NoError(t, err)
+		assert.Equal(t, expected, address, source)
+	}
+	_, err := parseProviderSource("azurerm", "a/b/c/d")
+	assert.Error(t, err)
+}
+
+func TestProviderRequirements_mergeModuleAndExample(t *testing.T) {
+	moduleDir := t.TempDir()
+	exampleDir := filepath.Join(moduleDir, "examples", "startup")
+	require.NoError(t, os.MkdirAll(exampleDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "versions.tf"), []byte(`
+terraform {
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = ">= 3.40, < 4.0"
+    }
+    azapi = {
+      source = "Azure/azapi"
+    }
+  }
+}
+`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(exampleDir, "main.tf"), []byte(`
+terraform {
+  required_providers {
+    arm = {
+      source  = "hashicorp/azurerm"
+      version = "~> 3.50"
+    }
+  }
+}
+`), 0600))
+	requirements, err := providerRequirements(moduleDir, exampleDir)
+	require.NoError(t, err)
+	require.Len(t, requirements, 2)
+	assert.Equal(t, "registry.terraform.io/hashicorp/azurerm", requirements["arm"].address.source())
+	assert.ElementsMatch(t, []string{">= 3.40, < 4.0", "~> 3.50"}, requirements["arm"].constraints)
+	assert.True(t, requirements["arm"].hasLowerBound())
+	assert.False(t, requirements["azapi"].hasLowerBound())
+}
+
+func TestProviderRequirement_hasLowerBound(t *testing.T) {
+	cases := map[string]bool{
+		">= 3.40":       true,
+		"> 3.40":        true,
+		"~> 3.40":       true,
+		"= 3.40.0":      true,
+		"3.40.0":        true,
+		"< 4.0":         false,
+		"<= 4.0, != 3":  false,
+		"< 4.0, >= 3.1": true,
+	}
+	for constraint, expected := range cases {
+		r := &providerRequirement{constraints: []string{constraint}}
+		assert.Equal(t, expected, r.hasLowerBound(), constraint)
+	}
+}
+
+func TestProviderRequirement_lowestVersionFromFilesystemMirror(t *testing.T) {
+	mirror := t.TempDir()
+	providerDir := filepath.Join(mirror, "registry.terraform.io", "hashicorp", "azurerm")
+	platform := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+	for _, v := range []string{"3.39.0", "3.41.0", "4.0.0"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(providerDir, v, platform), 0750))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(providerDir, "3.40.0", "other_platform"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(providerDir, fmt.Sprintf("terraform-provider-azurerm_3.40.1_%s.zip", platform)), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(providerDir, fmt.Sprintf("terraform-provider-azurerm_3.40.2-beta1_%s.zip", platform)), nil, 0600))
+	r := &providerRequirement{
+		address:     providerAddress{hostname: defaultProviderRegistryHost, namespace: "hashicorp", name: "azurerm"},
+		constraints: []string{">= 3.40, < 4.0"},
+	}
+	v, err := r.lowestVersion(filesystemMirror(mirror))
+	require.NoError(t, err)
+	assert.Equal(t, "3.40.1", v.String())
+
+	r.constraints = []string{">= 5.0"}
+	_, err = r.lowestVersion(filesystemMirror(mirror))
+	assert.Error(t, err)
+}
+
+func TestProviderRequirement_lowestVersionFromNetworkMirror(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/mirror/registry.terraform.io/azure/azapi/index.json", r.URL.Path)
+		_, _ = w.Write([]byte(`{"versions":{"1.0.0":{},"1.5.0":{},"2.0.0":{}}}`))
+	}))
+	defer server.Close()
+	r := &providerRequirement{
+		address:     providerAddress{hostname: defaultProviderRegistryHost, namespace: "azure", name: "azapi"},
+		constraints: []string{"~> 1.1"},
+	}
+	v, err := r.lowestVersion(networkMirror(server.URL + "/mirror/"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.5.0", v.String())
+}
+
+func TestProviderRequirement_lowestVersionFromOriginRegistry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/providers/hashicorp/random/versions", r.URL.Path)
+		_, _ = fmt.Fprintf(w, `{"versions":[
+			{"version":"3.0.0","platforms":[{"os":"plan9","arch":"386"}]},
+			{"version":"3.1.0","platforms":[{"os":%q,"arch":%q}]},
+			{"version":"3.2.0","platforms":[{"os":%q,"arch":%q}]}
+		]}`, runtime.GOOS, runtime.GOARCH, runtime.GOOS, runtime.GOARCH)
+	}))
+	defer server.Close()
+	r := &providerRequirement{
+		address:     providerAddress{hostname: defaultProviderRegistryHost, namespace: "hashicorp", name: "random"},
+		constraints: []string{">= 3.0"},
+	}
+	v, err := r.lowestVersion(originRegistry{baseUrl: server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, "3.1.0", v.String())
+}
+
+func TestPinProviderVersions(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, terraformLockFileName), []byte("lock"), 0600))
+	require.NoError(t, pinProviderVersions(dir, map[string]providerPin{
+		"azurerm": {source: "registry.terraform.io/hashicorp/azurerm", version: "3.40.1"},
+		"azapi":   {source: "registry.terraform.io/azure/azapi", version: "1.5.0"},
+	}))
+	_, err := os.Stat(filepath.Join(dir, terraformLockFileName))
+	assert.True(t, os.IsNotExist(err))
+	content, err := os.ReadFile(filepath.Join(dir, minProviderVersionsOverride))
+	require.NoError(t, err)
+	assert.Equal(t, `terraform {
+  required_providers {
+    azapi = {
+      source  = "registry.terraform.io/azure/azapi"
+      version = "1.5.0"
+    }
+    azurerm = {
+      source  = "registry.terraform.io/hashicorp/azurerm"
+      version = "3.40.1"
+    }
+  }
+}
+`, string(content))
+}
+
+func TestMinProviderVersionOptions_cliConfig(t *testing.T) {
+	t.Setenv(providerFilesystemMirrorEnv, "")
+	t.Setenv(providerNetworkMirrorEnv, "https://mirror.example.com/providers")
+	opts := MinProviderVersionOptions{}.withDefaults()
+	assert.Equal(t, "provider_installation {\n  network_mirror {\n    url = \"https://mirror.example.com/providers/\"\n  }\n}\n", opts.cliConfig())
+	assert.Equal(t, "", MinProviderVersionOptions{}.cliConfig())
+}
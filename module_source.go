@@ -0,0 +1,156 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SourceRedirect re-points module blocks whose source matches Pattern to the code under test.
+type SourceRedirect struct {
+	// Pattern is a regular expression matched against the whole source.
+	Pattern string
+	// Submodule is the folder under the module root the source points to, it can refer to Pattern's groups like `$1`. Empty means the module root.
+	Submodule string
+}
+
+var defaultSourceRedirects = []SourceRedirect{
+	{Pattern: `^\.\./\.\./?$`},
+	{Pattern: `^\.\./\.\./(modules/[^?]+?)/?$`, Submodule: "$1"},
+}
+
+// RegistrySourceRedirect matches the module's registry address, with or without the registry host, and its submodules like `Azure/aks/azurerm//modules/node_pool`.
+func RegistrySourceRedirect(namespace, name, provider string) SourceRedirect {
+	return SourceRedirect{
+		Pattern:   fmt.Sprintf(`(?i)^(registry\.terraform\.io/)?%s/%s/%s(//([^?]*?))?/?$`, regexp.QuoteMeta(namespace), regexp.QuoteMeta(name), regexp.QuoteMeta(provider)),
+		Submodule: "$3",
+	}
+}
+
+// GitSourceRedirect matches the module's git URL, with or without `git::` and `.git`, along with submodules and refs like `github.com/Azure/terraform-azurerm-aks//modules/node_pool?ref=v7.0.0`.
+func GitSourceRedirect(url string) SourceRedirect {
+	return SourceRedirect{
+		Pattern:   fmt.Sprintf(`^(git::)?%s(\.git)?(//([^?]*?))?/?(\?.*)?$`, regexp.QuoteMeta(strings.TrimSuffix(url, ".git"))),
+		Submodule: "$4",
+	}
+}
+
+// rewriteHcl re-points the example's module blocks to the code under test, it's an error when no module block was redirected,
+// since the upgrade test would test the old version twice.
+func rewriteHcl(moduleDir string, redirects []SourceRedirect, newModuleSource string) error {
+	return redirectModuleSourcesE(moduleDir, exampleSourceRedirects(redirects), newModuleSource)
+}
+
+// exampleSourceRedirects returns the default redirects along with the test's own ones.
+func exampleSourceRedirects(redirects []SourceRedirect) []SourceRedirect {
+	return append(append([]SourceRedirect{}, defaultSourceRedirects...), redirects...)
+}
+
+// folderSourceRedirect matches sources pointing to dir or a folder under it, like sources that a previous redirect wrote.
+func folderSourceRedirect(dir string) SourceRedirect {
+	return SourceRedirect{
+		Pattern:   fmt.Sprintf(`^%s(/(.*))?$`, regexp.QuoteMeta(strings.TrimSuffix(dir, "/"))),
+		Submodule: "$2",
+	}
+}
+
+func redirectModuleSourcesE(moduleDir string, redirects []SourceRedirect, newModuleRoot string) error {
+	redirected, err := redirectModuleSources(moduleDir, redirects, newModuleRoot)
+	if err != nil {
+		return err
+	}
+	if redirected == 0 {
+		return fmt.Errorf("no module block in %s was redirected to %s, set SourceRedirects in the upgrade options to match the example's module sources", moduleDir, newModuleRoot)
+	}
+	return nil
+}
+
+// redirectModuleSources sets the source of module blocks matching redirects to the submodule under newModuleRoot, and removes their `version`,
+// which only registry sources accept. It returns how many module blocks were redirected.
+func redirectModuleSources(moduleDir string, redirects []SourceRedirect, newModuleRoot string) (int, error) {
+	var regexes []*regexp.Regexp
+	for _, r := range redirects {
+		regex, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return 0, fmt.Errorf("invalid module source pattern %s: %s", r.Pattern, err.Error())
+		}
+		regexes = append(regexes, regex)
+	}
+	entries, err := os.ReadDir(moduleDir)
+	if err != nil {
+		return 0, err
+	}
+	redirected := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tf") {
+			continue
+		}
+		filePath := filepath.Clean(filepath.Join(moduleDir, entry.Name()))
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return 0, err
+		}
+		f, diag := hclwrite.ParseConfig(content, filePath, hcl.InitialPos)
+		if diag.HasErrors() {
+			return 0, diag
+		}
+		changed := false
+		for _, block := range f.Body().Blocks() {
+			if block.Type() != "module" {
+				continue
+			}
+			source, ok := literalString(block.Body().GetAttribute("source"))
+			if !ok {
+				continue
+			}
+			for i, regex := range regexes {
+				match := regex.FindStringSubmatchIndex(source)
+				if match == nil {
+					continue
+				}
+				submodule := string(regex.ExpandString(nil, redirects[i].Submodule, source, match))
+				block.Body().SetAttributeValue("source", cty.StringVal(joinModuleSource(newModuleRoot, submodule)))
+				block.Body().RemoveAttribute("version")
+				changed = true
+				redirected++
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err = os.WriteFile(filePath, f.Bytes(), 0600); err != nil {
+			return 0, err
+		}
+	}
+	return redirected, nil
+}
+
+// literalString returns the value of an attribute that is a plain quoted string.
+func literalString(attr *hclwrite.Attribute) (string, bool) {
+	if attr == nil {
+		return "", false
+	}
+	expr := strings.TrimSpace(string(attr.Expr().BuildTokens(nil).Bytes()))
+	if strings.Contains(expr, "${") {
+		return "", false
+	}
+	s, err := strconv.Unquote(expr)
+	return s, err == nil
+}
+
+// joinModuleSource keeps root's `./` or `../` prefix, which tells Terraform a local path from a registry address.
+func joinModuleSource(root, submodule string) string {
+	submodule = strings.Trim(submodule, "/")
+	if submodule == "" {
+		return root
+	}
+	return strings.TrimSuffix(root, "/") + "/" + submodule
+}
@@ -0,0 +1,103 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectModuleSources(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`module "root" {
+  source = "../.."
+}
+
+module "submodule" {
+  source = "../../modules/node_pool"
+}
+
+module "registry" {
+  source  = "Azure/aks/azurerm"
+  version = "7.5.0"
+  prefix  = "test"
+}
+
+module "registry_submodule" {
+  source  = "registry.terraform.io/Azure/aks/azurerm//modules/node_pool"
+  version = "~> 7.0"
+}
+
+module "git" {
+  source = "git::https://github.com/Azure/terraform-azurerm-aks.git//modules/node_pool?ref=v7.5.0"
+}
+
+module "other" {
+  source  = "Azure/network/azurerm"
+  version = "5.0.0"
+}
+
+module "interpolated" {
+  source = "${path.module}/../.."
+}
+`), 0600))
+	redirects := exampleSourceRedirects([]SourceRedirect{RegistrySourceRedirect("Azure", "aks", "azurerm"), GitSourceRedirect("https://github.com/Azure/terraform-azurerm-aks")})
+	redirected, err := redirectModuleSources(dir, redirects, "../../../current")
+	require.NoError(t, err)
+	assert.Equal(t, 5, redirected)
+	content, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, `module "root" {
+  source = "../../../current"
+}
+
+module "submodule" {
+  source = "../../../current/modules/node_pool"
+}
+
+module "registry" {
+  source = "../../../current"
+  prefix = "test"
+}
+
+module "registry_submodule" {
+  source = "../../../current/modules/node_pool"
+}
+
+module "git" {
+  source = "../../../current/modules/node_pool"
+}
+
+module "other" {
+  source  = "Azure/network/azurerm"
+  version = "5.0.0"
+}
+
+module "interpolated" {
+  source = "${path.module}/../.."
+}
+`, string(content))
+
+	redirected, err = redirectModuleSources(dir, []SourceRedirect{folderSourceRedirect("../../../current")}, "/tmp/v7.6.0")
+	require.NoError(t, err)
+	assert.Equal(t, 5, redirected)
+	content, err = os.ReadFile(filepath.Join(dir, "main.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `source = "/tmp/v7.6.0/modules/node_pool"`)
+}
+
+func TestRewriteHclFailsWhenNothingRedirected(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`module "registry" {
+  source  = "Azure/aks/azurerm"
+  version = "7.5.0"
+}
+`), 0600))
+	err := rewriteHcl(dir, nil, "/module")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no module block")
+
+	require.NoError(t, rewriteHcl(dir, []SourceRedirect{RegistrySourceRedirect("Azure", "aks", "azurerm")}, "/module"))
+}
@@ -0,0 +1,141 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// terraformOutput is an output in `terraform output -json`, Type is cty's JSON type like `"string"` or `["object",{"id":"string"}]`.
+type terraformOutput struct {
+	Sensitive bool        `json:"sensitive"`
+	Type      interface{} `json:"type"`
+	Value     interface{} `json:"value"`
+}
+
+func terraformOutputs(t terratest.TestingT, opts terraform.Options) (map[string]terraformOutput, error) {
+	opts.Logger = logger.Discard
+	raw, err := terraform.OutputJsonE(t, &opts, "")
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]terraformOutput)
+	if err = json.Unmarshal([]byte(raw), &outputs); err != nil {
+		return nil, fmt.Errorf("cannot parse terraform outputs: %s", err.Error())
+	}
+	return outputs, nil
+}
+
+// unstableOutputs lists outputs that disappeared or changed type incompatibly, along with outputs whose value changed, sorted by name.
+// New outputs are fine, so is a type that only adds attributes to objects.
+func unstableOutputs(before, after map[string]terraformOutput, ignores []string) (broken []string, valueChanged []string, err error) {
+	var regexes []*regexp.Regexp
+	for _, ignore := range ignores {
+		r, err := regexp.Compile(ignore)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid output ignore pattern %s: %s", ignore, err.Error())
+		}
+		regexes = append(regexes, r)
+	}
+	for _, name := range sortedKeys(before) {
+		ignored := linq.From(regexes).AnyWith(func(i interface{}) bool {
+			return i.(*regexp.Regexp).MatchString(name)
+		})
+		if ignored {
+			continue
+		}
+		b := before[name]
+		a, ok := after[name]
+		switch {
+		case !ok:
+			broken = append(broken, fmt.Sprintf("  %s: removed", name))
+		case !typeCompatible(b.Type, a.Type):
+			broken = append(broken, fmt.Sprintf("  %s: type %s -> %s", name, typeString(b.Type), typeString(a.Type)))
+		case !reflect.DeepEqual(b.Value, a.Value):
+			valueChanged = append(valueChanged, fmt.Sprintf("  %s: value changed", name))
+		}
+	}
+	return broken, valueChanged, nil
+}
+
+// typeCompatible tells whether consumers of the before type can read the after type, objects might gain attributes, nested types are checked recursively.
+func typeCompatible(before, after interface{}) bool {
+	if reflect.DeepEqual(before, after) {
+		return true
+	}
+	b, ok := before.([]interface{})
+	if !ok || len(b) != 2 {
+		return false
+	}
+	a, ok := after.([]interface{})
+	if !ok || len(a) != 2 || b[0] != a[0] {
+		return false
+	}
+	switch b[0] {
+	case "object":
+		bAttrs, ok1 := b[1].(map[string]interface{})
+		aAttrs, ok2 := a[1].(map[string]interface{})
+		if !ok1 || !ok2 {
+			return false
+		}
+		for attr, t := range bAttrs {
+			if at, ok := aAttrs[attr]; !ok || !typeCompatible(t, at) {
+				return false
+			}
+		}
+		return true
+	case "tuple":
+		bElems, ok1 := b[1].([]interface{})
+		aElems, ok2 := a[1].([]interface{})
+		if !ok1 || !ok2 || len(bElems) != len(aElems) {
+			return false
+		}
+		for i := range bElems {
+			if !typeCompatible(bElems[i], aElems[i]) {
+				return false
+			}
+		}
+		return true
+	case "list", "set", "map":
+		return typeCompatible(b[1], a[1])
+	}
+	return false
+}
+
+func typeString(t interface{}) string {
+	s, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Sprintf("%v", t)
+	}
+	return string(s)
+}
+
+// checkOutputStability applies the upgraded configuration, which writes the new outputs along with any change the upgrade policy allowed, then compares outputs with before.
+// Outputs whose names match ignores, which are regular expressions, are left out.
+func checkOutputStability(t *T, opts terraform.Options, before map[string]terraformOutput, ignores []string) error {
+	if _, err := terraform.ApplyE(t, &opts); err != nil {
+		return err
+	}
+	after, err := terraformOutputs(t, opts)
+	if err != nil {
+		return err
+	}
+	broken, valueChanged, err := unstableOutputs(before, after, ignores)
+	if err != nil {
+		return err
+	}
+	if len(valueChanged) > 0 {
+		logger.Log(t, fmt.Sprintf("===> outputs changed value after upgrade:\n%s", strings.Join(valueChanged, "\n")))
+	}
+	if len(broken) > 0 {
+		return fmt.Errorf("outputs are not stable after upgrade:\n%s", strings.Join(broken, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseOutputs(t *testing.T, raw string) map[string]terraformOutput {
+	outputs := make(map[string]terraformOutput)
+	require.NoError(t, json.Unmarshal([]byte(raw), &outputs))
+	return outputs
+}
+
+func TestUnstableOutputs(t *testing.T) {
+	before := parseOutputs(t, `{
+  "complete": {"sensitive": false, "type": ["object", {"id": "number"}], "value": {"id": 3}},
+  "id": {"sensitive": false, "type": "number", "value": 3},
+  "ids": {"sensitive": false, "type": ["list", "string"], "value": ["a"]},
+  "name": {"sensitive": false, "type": "string", "value": "pet"},
+  "removed": {"sensitive": false, "type": "string", "value": "x"},
+  "timestamp": {"sensitive": false, "type": "string", "value": "2023-01-01"}
+}`)
+	after := parseOutputs(t, `{
+  "complete": {"sensitive": false, "type": ["object", {"id": "number", "name": "string"}], "value": {"id": 3, "name": "pet"}},
+  "id": {"sensitive": false, "type": "number", "value": 5},
+  "ids": {"sensitive": false, "type": ["set", "string"], "value": ["a"]},
+  "name": {"sensitive": false, "type": "number", "value": 1},
+  "new": {"sensitive": false, "type": "string", "value": "y"},
+  "timestamp": {"sensitive": false, "type": "number", "value": 1672531200}
+}`)
+	broken, valueChanged, err := unstableOutputs(before, after, []string{"^timestamp$"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`  ids: type ["list","string"] -> ["set","string"]`,
+		`  name: type "string" -> "number"`,
+		"  removed: removed",
+	}, broken)
+	assert.Equal(t, []string{
+		"  complete: value changed",
+		"  id: value changed",
+	}, valueChanged)
+
+	_, _, err = unstableOutputs(before, after, []string{"("})
+	assert.Error(t, err)
+}
+
+func TestTypeCompatible(t *testing.T) {
+	parse := func(s string) interface{} {
+		var v interface{}
+		require.NoError(t, json.Unmarshal([]byte(s), &v))
+		return v
+	}
+	cases := []struct {
+		before     string
+		after      string
+		compatible bool
+	}{
+		{`"string"`, `"string"`, true},
+		{`"string"`, `"number"`, false},
+		{`["object",{"id":"string"}]`, `["object",{"id":"string","name":"string"}]`, true},
+		{`["object",{"id":"string","name":"string"}]`, `["object",{"id":"string"}]`, false},
+		{`["list",["object",{"id":"string"}]]`, `["list",["object",{"id":"string","name":"string"}]]`, true},
+		{`["map",["object",{"id":"string"}]]`, `["map",["object",{"id":"number"}]]`, false},
+		{`["tuple",["string","number"]]`, `["tuple",["string"]]`, false},
+		{`["tuple",["string",["object",{}]]]`, `["tuple",["string",["object",{"id":"string"}]]]`, true},
+		{`["list","string"]`, `"string"`, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.compatible, typeCompatible(parse(c.before), parse(c.after)), "%s -> %s", c.before, c.after)
+	}
+}
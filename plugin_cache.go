@@ -0,0 +1,262 @@
+package terraform_module_test_helper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+const (
+	pluginCacheDirEnv                = "TF_PLUGIN_CACHE_DIR"
+	pluginCacheMayBreakLockFileEnv   = "TF_PLUGIN_CACHE_MAY_BREAK_DEPENDENCY_LOCK_FILE"
+	pluginCacheRunDirPrefix          = "run-"
+	pluginCacheWarmedConfigsFolder   = "warmed"
+	pluginCacheWarmedProvidersFolder = "warmed-providers"
+	pluginCacheLockTimeout           = 30 * time.Minute
+	pluginCacheDefaultProvidersDir   = "providers"
+	pluginCacheDefaultRootFolderName = "plugin-cache"
+)
+
+var pruneStaleRunsOnce = &sync.Once{}
+
+// initWithPluginCache runs init with a plugin cache shared by all tests in this run, including tests in other packages' processes started by the same `go test`.
+// Terraform doesn't guard concurrent writes to the cache, so the providers a configuration requires are installed into the cache first by warmPluginCache,
+// then init only reads from the cache and runs in parallel with other inits.
+func initWithPluginCache(t terratest.TestingT, options *terraform.Options, init func(terratest.TestingT, *terraform.Options) (string, error)) (string, error) {
+	runDir := pluginCacheRunDir()
+	cacheDir := options.EnvVars[pluginCacheDirEnv]
+	if cacheDir == "" {
+		cacheDir = os.Getenv(pluginCacheDirEnv)
+	}
+	if cacheDir == "" {
+		cacheDir = filepath.Join(runDir, pluginCacheDefaultProvidersDir)
+	}
+	if err := os.MkdirAll(cacheDir, 0750); err != nil {
+		return "", err
+	}
+	envVars := make(map[string]string, len(options.EnvVars)+2)
+	envVars[pluginCacheMayBreakLockFileEnv] = "true"
+	for k, v := range options.EnvVars {
+		envVars[k] = v
+	}
+	envVars[pluginCacheDirEnv] = cacheDir
+	options.EnvVars = envVars
+
+	if output, err := warmPluginCache(t, runDir, cacheDir, options, init); err != nil {
+		return output, err
+	}
+	return init(t, options)
+}
+
+// warmPluginCache installs the union of `required_providers` of the configuration and its modules into the cache, including providers implied by resources.
+// Every provider, identified by its source and version constraints, is installed once per run by a throwaway configuration under a cross-process lock of its own,
+// so configurations that require different providers warm them in parallel, and configurations that share providers don't download them again.
+func warmPluginCache(t terratest.TestingT, runDir, cacheDir string, options *terraform.Options, init func(terratest.TestingT, *terraform.Options) (string, error)) (string, error) {
+	key, err := warmKey(cacheDir, options)
+	if err != nil {
+		return "", err
+	}
+	marker := filepath.Join(runDir, pluginCacheWarmedConfigsFolder, key)
+	if files.FileExists(marker) {
+		return "", nil
+	}
+	requirements, err := configurationProviderRequirements(t, options)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range sortedKeys(requirements) {
+		if output, err := warmProvider(t, runDir, cacheDir, options, name, requirements[name], init); err != nil {
+			return output, err
+		}
+	}
+	return "", writeMarker(marker, options.TerraformDir)
+}
+
+// configurationProviderRequirements reads `required_providers` of the configuration, and of its modules once `terraform get` installed them.
+func configurationProviderRequirements(t terratest.TestingT, options *terraform.Options) (map[string]*providerRequirement, error) {
+	root, diag := tfconfig.LoadModule(options.TerraformDir)
+	if diag.HasErrors() {
+		return nil, diag
+	}
+	dirs := []string{options.TerraformDir}
+	if len(root.ModuleCalls) > 0 {
+		if output, err := getModules(t, options); err != nil {
+			return nil, fmt.Errorf("cannot install modules: %s", output)
+		}
+		moduleDirs, err := installedModuleDirs(options.TerraformDir)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, moduleDirs...)
+	}
+	return providerRequirements(dirs...)
+}
+
+var getModules = func(t terratest.TestingT, options *terraform.Options) (string, error) {
+	return terraform.GetE(t, options)
+}
+
+// installedModuleDirs reads the folders of the modules `terraform get` installed from `.terraform/modules/modules.json`.
+func installedModuleDirs(terraformDir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(terraformDir, ".terraform", "modules", "modules.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Modules []struct {
+			Key string `json:"Key"`
+			Dir string `json:"Dir"`
+		} `json:"Modules"`
+	}
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse modules manifest of %s: %s", terraformDir, err.Error())
+	}
+	var dirs []string
+	for _, m := range manifest.Modules {
+		if m.Key == "" {
+			continue
+		}
+		dir := m.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(terraformDir, dir)
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// warmProvider installs the provider into the cache by initializing a configuration that only requires it. The configuration's lock file is copied along,
+// so the cache gets the same version the configuration's init picks.
+func warmProvider(t terratest.TestingT, runDir, cacheDir string, options *terraform.Options, localName string, requirement *providerRequirement, init func(terratest.TestingT, *terraform.Options) (string, error)) (string, error) {
+	key := hash(fmt.Sprintf("%s\n%s\n%t\n%s\n%s", cacheDir, options.TerraformBinary, options.Upgrade, requirement.address, strings.Join(requirement.constraints, ",")))
+	marker := filepath.Join(runDir, pluginCacheWarmedProvidersFolder, key)
+	if files.FileExists(marker) {
+		return "", nil
+	}
+	lock := newFileLock(filepath.Join(pluginCacheRoot(), key+".lock"))
+	lock.timeout = pluginCacheLockTimeout
+	unlock, err := lock.Lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if files.FileExists(marker) {
+		return "", nil
+	}
+	dir, err := os.MkdirTemp("", "plugin-cache-warm")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	version := ""
+	if len(requirement.constraints) > 0 {
+		version = fmt.Sprintf("      version = %q\n", strings.Join(requirement.constraints, ", "))
+	}
+	config := fmt.Sprintf("terraform {\n  required_providers {\n    %s = {\n      source  = %q\n%s    }\n  }\n}\n", localName, requirement.address.source(), version)
+	if err = os.WriteFile(filepath.Join(dir, "main.tf"), []byte(config), 0600); err != nil {
+		return "", err
+	}
+	lockFile := filepath.Join(options.TerraformDir, terraformLockFileName)
+	if !options.Upgrade && files.FileExists(lockFile) {
+		if err = copyFile(lockFile, filepath.Join(dir, terraformLockFileName)); err != nil {
+			return "", err
+		}
+	}
+	warmOptions := *options
+	warmOptions.TerraformDir = dir
+	warmOptions.BackendConfig = nil
+	warmOptions.Reconfigure = false
+	if output, err := init(t, &warmOptions); err != nil {
+		return output, err
+	}
+	return "", writeMarker(marker, requirement.address.source())
+}
+
+func writeMarker(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0600)
+}
+
+// warmKey identifies the providers an init would install, by the cache, the binary, the upgrade flag and the root configuration's content.
+// Copies of the same example share the key, an upgrade test that redirects module source to the current code gets a new one.
+func warmKey(cacheDir string, options *terraform.Options) (string, error) {
+	entries, err := os.ReadDir(options.TerraformDir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json") || name == ".terraform.lock.hcl" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%t\n", cacheDir, options.TerraformBinary, options.Upgrade)
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(options.TerraformDir, name))
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintf(h, "%s\n%d\n", name, len(content))
+		_, _ = h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func pluginCacheRoot() string {
+	return filepath.Join(os.TempDir(), "terraform-module-test-helper", pluginCacheDefaultRootFolderName)
+}
+
+// pluginCacheRunDir returns the folder of current run, `go test ./...` starts one process per package from the same parent process,
+// so the parent's pid identifies the run. Folders left by runs that have finished are pruned.
+func pluginCacheRunDir() string {
+	pruneStaleRunsOnce.Do(pruneStalePluginCacheRuns)
+	return filepath.Join(pluginCacheRoot(), fmt.Sprintf("%s%d", pluginCacheRunDirPrefix, os.Getppid()))
+}
+
+func pruneStalePluginCacheRuns() {
+	entries, err := os.ReadDir(pluginCacheRoot())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), pluginCacheRunDirPrefix) {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), pluginCacheRunDirPrefix))
+		if err != nil || pid == os.Getppid() || processAlive(pid) {
+			continue
+		}
+		_ = os.RemoveAll(filepath.Join(pluginCacheRoot(), entry.Name()))
+	}
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,216 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const twoProvidersConfig = `terraform {
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = ">= 3.0"
+    }
+  }
+}
+
+resource "random_pet" "this" {}
+`
+
+// lockHeld tells whether any plugin cache lock file exists.
+func lockHeld(t *testing.T) bool {
+	locks, err := filepath.Glob(filepath.Join(pluginCacheRoot(), "*.lock"))
+	require.NoError(t, err)
+	return len(locks) > 0
+}
+
+func TestInitWithPluginCache_warmsProvidersUnderLockThenInitsWithoutLock(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv(pluginCacheDirEnv, "")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(twoProvidersConfig), 0600))
+	envVars := map[string]string{"TEST_ENV": "1"}
+	var warmed []string
+	var exampleLocked []bool
+	init := func(tt terratest.TestingT, options *terraform.Options) (string, error) {
+		if options.TerraformDir == dir {
+			exampleLocked = append(exampleLocked, lockHeld(t))
+			return "", nil
+		}
+		assert.True(t, lockHeld(t))
+		content, err := os.ReadFile(filepath.Join(options.TerraformDir, "main.tf"))
+		require.NoError(t, err)
+		warmed = append(warmed, string(content))
+		return "", nil
+	}
+	for i := 0; i < 2; i++ {
+		options := &terraform.Options{TerraformDir: dir, EnvVars: envVars}
+		_, err := initWithPluginCache(newT(t), options, init)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(pluginCacheRunDir(), pluginCacheDefaultProvidersDir), options.EnvVars[pluginCacheDirEnv])
+		assert.Equal(t, "true", options.EnvVars[pluginCacheMayBreakLockFileEnv])
+		assert.Equal(t, "1", options.EnvVars["TEST_ENV"])
+	}
+	require.Len(t, warmed, 2)
+	assert.Contains(t, warmed[0], `source  = "registry.terraform.io/hashicorp/azurerm"`)
+	assert.Contains(t, warmed[0], `version = ">= 3.0"`)
+	assert.Contains(t, warmed[1], `source  = "registry.terraform.io/hashicorp/random"`)
+	assert.NotContains(t, warmed[1], "version")
+	assert.Equal(t, []bool{false, false}, exampleLocked)
+	assert.Len(t, envVars, 1, "caller's EnvVars should not be modified")
+}
+
+func TestInitWithPluginCache_failedWarmShouldNotWarmTheCache(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cacheDir := t.TempDir()
+	t.Setenv(pluginCacheDirEnv, cacheDir)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "null_resource" "this" {}`), 0600))
+	calls := 0
+	init := func(t terratest.TestingT, options *terraform.Options) (string, error) {
+		calls++
+		assert.Equal(t, cacheDir, options.EnvVars[pluginCacheDirEnv])
+		if calls == 1 {
+			return "network error", fmt.Errorf("init failed")
+		}
+		return "", nil
+	}
+	output, err := initWithPluginCache(newT(t), &terraform.Options{TerraformDir: dir}, init)
+	require.Error(t, err)
+	assert.Equal(t, "network error", output)
+	key, err := warmKey(cacheDir, &terraform.Options{TerraformDir: dir})
+	require.NoError(t, err)
+	assert.False(t, files.FileExists(filepath.Join(pluginCacheRunDir(), pluginCacheWarmedConfigsFolder, key)))
+	_, err = initWithPluginCache(newT(t), &terraform.Options{TerraformDir: dir}, init)
+	require.NoError(t, err)
+	assert.True(t, files.FileExists(filepath.Join(pluginCacheRunDir(), pluginCacheWarmedConfigsFolder, key)))
+	assert.Equal(t, 3, calls, "the failed warm should be retried, then the example's init runs")
+}
+
+func TestInitWithPluginCache_configurationsSharingProvidersWarmOnceAndInitInParallel(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv(pluginCacheDirEnv, "")
+	const examples = 3
+	var warms int32
+	arrived := sync.WaitGroup{}
+	arrived.Add(examples)
+	allArrived := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(allArrived)
+	}()
+	var dirs []string
+	for i := 0; i < examples; i++ {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(fmt.Sprintf("# %d\nresource \"null_resource\" \"this\" {}\n", i)), 0600))
+		dirs = append(dirs, dir)
+	}
+	init := func(t terratest.TestingT, options *terraform.Options) (string, error) {
+		if !linq.From(dirs).Contains(options.TerraformDir) {
+			atomic.AddInt32(&warms, 1)
+			time.Sleep(50 * time.Millisecond)
+			return "", nil
+		}
+		arrived.Done()
+		select {
+		case <-allArrived:
+			return "", nil
+		case <-time.After(10 * time.Second):
+			return "", fmt.Errorf("inits of different configurations should run in parallel")
+		}
+	}
+	wg := sync.WaitGroup{}
+	for _, dir := range dirs {
+		dir := dir
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := initWithPluginCache(newT(t), &terraform.Options{TerraformDir: dir}, init)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), warms)
+}
+
+func TestInitWithPluginCache_readsProvidersOfInstalledModules(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv(pluginCacheDirEnv, "")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`module "this" {
+  source = "Azure/aks/azurerm"
+}
+`), 0600))
+	moduleDir := filepath.Join(dir, ".terraform", "modules", "this")
+	stub := gostub.Stub(&getModules, func(t terratest.TestingT, options *terraform.Options) (string, error) {
+		require.NoError(t, os.MkdirAll(moduleDir, 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte(`terraform {
+  required_providers {
+    azapi = {
+      source = "Azure/azapi"
+    }
+  }
+}
+`), 0600))
+		return "", os.WriteFile(filepath.Join(dir, ".terraform", "modules", "modules.json"), []byte(`{"Modules":[{"Key":"","Source":"","Dir":"."},{"Key":"this","Source":"registry.terraform.io/Azure/aks/azurerm","Dir":".terraform/modules/this"}]}`), 0600)
+	})
+	defer stub.Reset()
+	var warmed []string
+	init := func(t terratest.TestingT, options *terraform.Options) (string, error) {
+		if options.TerraformDir != dir {
+			content, err := os.ReadFile(filepath.Join(options.TerraformDir, "main.tf"))
+			require.NoError(t, err)
+			warmed = append(warmed, string(content))
+		}
+		return "", nil
+	}
+	_, err := initWithPluginCache(newT(t), &terraform.Options{TerraformDir: dir}, init)
+	require.NoError(t, err)
+	require.Len(t, warmed, 1)
+	assert.Contains(t, warmed[0], `source  = "registry.terraform.io/azure/azapi"`)
+}
+
+func TestWarmKey(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+	for _, dir := range []string{dir1, dir2} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`module "this" { source = "../../" }`), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte(dir), 0600))
+	}
+	key1, err := warmKey("/cache", &terraform.Options{TerraformDir: dir1})
+	require.NoError(t, err)
+	key2, err := warmKey("/cache", &terraform.Options{TerraformDir: dir2})
+	require.NoError(t, err)
+	assert.Equal(t, key1, key2, "copies of the same configuration should share the key")
+	upgrade, err := warmKey("/cache", &terraform.Options{TerraformDir: dir1, Upgrade: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, key1, upgrade)
+	require.NoError(t, os.WriteFile(filepath.Join(dir2, "override.tf"), []byte(`module "this" { source = "/current" }`), 0600))
+	key2, err = warmKey("/cache", &terraform.Options{TerraformDir: dir2})
+	require.NoError(t, err)
+	assert.NotEqual(t, key1, key2)
+}
+
+func TestPruneStalePluginCacheRuns(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dead := filepath.Join(pluginCacheRoot(), fmt.Sprintf("%s%d", pluginCacheRunDirPrefix, deadPid))
+	alive := filepath.Join(pluginCacheRoot(), fmt.Sprintf("%s%d", pluginCacheRunDirPrefix, os.Getpid()))
+	require.NoError(t, os.MkdirAll(dead, 0750))
+	require.NoError(t, os.MkdirAll(alive, 0750))
+	pruneStalePluginCacheRuns()
+	assert.False(t, files.IsExistingDir(dead))
+	assert.True(t, files.IsExistingDir(alive))
+}
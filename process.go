@@ -0,0 +1,16 @@
+//go:build !windows
+
+package terraform_module_test_helper
+
+import (
+	"os"
+	"syscall"
+)
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
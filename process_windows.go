@@ -0,0 +1,27 @@
+package terraform_module_test_helper
+
+import (
+	"syscall"
+)
+
+const (
+	// stillActive is the exit code GetExitCodeProcess reports for a running process.
+	stillActive = 259
+	// errorInvalidParameter is what OpenProcess returns for a pid that doesn't exist.
+	errorInvalidParameter syscall.Errno = 87
+)
+
+// processAlive opens the process to read its exit code, since signals don't exist on Windows.
+// A process we cannot open for other reasons than it doesn't exist, like access denied, is treated as alive.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err != errorInvalidParameter
+	}
+	defer func() { _ = syscall.CloseHandle(h) }()
+	var code uint32
+	if err = syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -0,0 +1,199 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/stretchr/testify/require"
+)
+
+var NoBaselineLockFileError = fmt.Errorf("no baseline lock file, commit the example's `.terraform.lock.hcl` or set ProviderUpgradeOptions.BaselineLockFile, skip provider upgrade test")
+
+type ProviderUpgradeOptions struct {
+	// BaselineLockFile is the lock file to apply with, default to the example's committed `.terraform.lock.hcl`.
+	BaselineLockFile string
+	// IdempotentIgnores are regular expressions matched against resource addresses, matched resources' changes are ignored.
+	IdempotentIgnores []string
+	// Policy decides which changes fail the test, like `ChangePolicy{Allowed: []ChangeKind{ChangeUpdate}}`, IdempotentIgnores are added to its Ignores.
+	Policy ChangePolicy
+}
+
+// ProviderUpgradeTest applies the example with the providers locked by the baseline lock file, then re-inits with `-upgrade` to the newest allowed providers,
+// and fails when the plan doesn't pass upgradeOpts.Policy, any change fails by default. The report groups the changes by the provider that manages the resources, along with the provider's version bump.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ProviderUpgradeTest(t *testing.T, moduleRootPath, exampleRelativePath string, opts terraform.Options, upgradeOpts ProviderUpgradeOptions) {
+	wrappedT := newT(t)
+	tryParallel(wrappedT)
+	defer coordinator.start(wrappedT)()
+	logger.Log(wrappedT, fmt.Sprintf("===> Starting provider upgrade test for %s, since we're running tests in parallel, the test log will be buffered and output to stdout after the test was finished.", filepath.Join(moduleRootPath, exampleRelativePath)))
+	l := NewMemoryLogger()
+	defer func() { _ = l.Close() }()
+	opts.Logger = logger.New(l)
+	opts = setupRetryLogic(opts)
+
+	tmpDir := copyTerraformFolderToTemp(wrappedT, moduleRootPath, exampleRelativePath)
+	defer func() {
+		removeWorkspace(t, tmpDir)
+	}()
+	err := providerUpgrade(wrappedT, retryableOptions(t, opts), moduleRootPath, exampleRelativePath, tmpDir, upgradeOpts)
+	if err == NoBaselineLockFileError {
+		t.Skip(err.Error())
+	}
+	require.NoError(wrappedT, err)
+}
+
+const (
+	providerLockedHop   = "locked"
+	providerUpgradedHop = "upgraded"
+)
+
+func providerUpgrade(t *T, opts terraform.Options, moduleRootPath, exampleRelativePath, terraformDir string, upgradeOpts ProviderUpgradeOptions) error {
+	report := newUpgradeReport(t, "provider", exampleRelativePath, providerLockedHop)
+	return report.save(t, processModuleRoot(moduleRootPath), upgradeProviders(t, opts, moduleRootPath, exampleRelativePath, terraformDir, upgradeOpts, report))
+}
+
+func upgradeProviders(t *T, opts terraform.Options, moduleRootPath, exampleRelativePath, terraformDir string, upgradeOpts ProviderUpgradeOptions, report *UpgradeReport) error {
+	lockFile := filepath.Join(terraformDir, terraformLockFileName)
+	if upgradeOpts.BaselineLockFile != "" {
+		if err := copyFile(upgradeOpts.BaselineLockFile, lockFile); err != nil {
+			return err
+		}
+	}
+	if !files.FileExists(lockFile) {
+		return NoBaselineLockFileError
+	}
+	opts.TerraformDir = terraformDir
+	opts.Upgrade = false
+	if err := renderTemplates(t, opts); err != nil {
+		return err
+	}
+	opts, err := isolateEnv(opts)
+	if err != nil {
+		return err
+	}
+	entry := registerWorkspace(t, moduleRootPath, exampleRelativePath, opts)
+	defer destroyTracked(t, opts, VerifyStateEmpty, entry)
+	initAndApply(t, &opts)
+	coordinator.failIfInterrupted(t)
+	before, err := readProviderLocks(lockFile)
+	if err != nil {
+		return err
+	}
+	opts.Upgrade = true
+	opts.Logger = logger.Discard
+	plan, reasons := initAndPlanWithActionReasons(t, opts)
+	after, err := readProviderLocks(lockFile)
+	if err != nil {
+		return err
+	}
+	bumps := providerBumps(before, after)
+	logger.Log(t, fmt.Sprintf("===> provider upgrades:\n%s", strings.Join(bumps.lines(), "\n")))
+	verdict, err := upgradeOpts.Policy.withIgnores(upgradeOpts.IdempotentIgnores).verdict(plan.ResourceChangesMap, reasons)
+	if err != nil {
+		return err
+	}
+	report.addHop(providerLockedHop, providerUpgradedHop, verdict)
+	if verdict.Passed {
+		return nil
+	}
+	return fmt.Errorf("provider upgrade produced changes:\n%s", providerUpgradeReport(bumps, verdict))
+}
+
+// readProviderLocks returns the locked version keyed by provider source address.
+func readProviderLocks(path string) (map[string]string, error) {
+	f, diag := hclparse.NewParser().ParseHCLFile(filepath.Clean(path))
+	if diag.HasErrors() {
+		return nil, diag
+	}
+	content, _, diag := f.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type:       "provider",
+				LabelNames: []string{"source"},
+			},
+		},
+	})
+	if diag.HasErrors() {
+		return nil, diag
+	}
+	locks := make(map[string]string)
+	for _, b := range content.Blocks {
+		attrs, _ := b.Body.JustAttributes()
+		attr, ok := attrs["version"]
+		if !ok {
+			continue
+		}
+		v, diag := attr.Expr.Value(nil)
+		if diag.HasErrors() {
+			return nil, diag
+		}
+		locks[b.Labels[0]] = v.AsString()
+	}
+	return locks, nil
+}
+
+type providerBump struct {
+	from string
+	to   string
+}
+
+type providerBumpMap map[string]providerBump
+
+func providerBumps(before, after map[string]string) providerBumpMap {
+	bumps := make(providerBumpMap)
+	for source, to := range after {
+		bumps[source] = providerBump{from: before[source], to: to}
+	}
+	for source, from := range before {
+		if _, ok := after[source]; !ok {
+			bumps[source] = providerBump{from: from}
+		}
+	}
+	return bumps
+}
+
+func (b providerBump) String() string {
+	switch {
+	case b.from == b.to:
+		return fmt.Sprintf("%s (not upgraded)", b.to)
+	case b.from == "":
+		return fmt.Sprintf("%s (new)", b.to)
+	case b.to == "":
+		return fmt.Sprintf("%s (removed)", b.from)
+	}
+	return fmt.Sprintf("%s -> %s", b.from, b.to)
+}
+
+func (m providerBumpMap) lines() []string {
+	var lines []string
+	for _, source := range sortedKeys(m) {
+		lines = append(lines, fmt.Sprintf("%s %s", source, m[source]))
+	}
+	return lines
+}
+
+// providerUpgradeReport lists the changed resources under the provider that manages them.
+func providerUpgradeReport(bumps providerBumpMap, verdict ChangeVerdict) string {
+	byProvider := make(map[string][]string)
+	for _, change := range verdict.Changes {
+		byProvider[change.ProviderName] = append(byProvider[change.ProviderName], fmt.Sprintf("  %s", change))
+	}
+	sb := strings.Builder{}
+	for _, provider := range sortedKeys(byProvider) {
+		bump, ok := bumps[provider]
+		header := provider
+		if ok {
+			header = fmt.Sprintf("%s %s", provider, bump)
+		}
+		sb.WriteString(fmt.Sprintf("%s:\n%s\n", header, strings.Join(byProvider[provider], "\n")))
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProviderLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), terraformLockFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`
+provider "registry.terraform.io/hashicorp/azurerm" {
+  version     = "3.40.0"
+  constraints = ">= 3.40.0"
+  hashes = [
+    "h1:abc",
+  ]
+}
+
+provider "registry.terraform.io/azure/azapi" {
+  version = "1.5.0"
+}
+`), 0600))
+	locks, err := readProviderLocks(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"registry.terraform.io/hashicorp/azurerm": "3.40.0",
+		"registry.terraform.io/azure/azapi":       "1.5.0",
+	}, locks)
+}
+
+func TestProviderBumps(t *testing.T) {
+	bumps := providerBumps(map[string]string{
+		"registry.terraform.io/hashicorp/azurerm": "3.40.0",
+		"registry.terraform.io/azure/azapi":       "1.5.0",
+		"registry.terraform.io/hashicorp/null":    "3.0.0",
+	}, map[string]string{
+		"registry.terraform.io/hashicorp/azurerm": "3.116.0",
+		"registry.terraform.io/azure/azapi":       "1.5.0",
+		"registry.terraform.io/hashicorp/random":  "3.6.0",
+	})
+	assert.Equal(t, []string{
+		"registry.terraform.io/azure/azapi 1.5.0 (not upgraded)",
+		"registry.terraform.io/hashicorp/azurerm 3.40.0 -> 3.116.0",
+		"registry.terraform.io/hashicorp/null 3.0.0 (removed)",
+		"registry.terraform.io/hashicorp/random 3.6.0 (new)",
+	}, bumps.lines())
+}
+
+func TestProviderUpgradeReport(t *testing.T) {
+	bumps := providerBumps(map[string]string{
+		"registry.terraform.io/hashicorp/azurerm": "3.40.0",
+		"registry.terraform.io/azure/azapi":       "1.5.0",
+	}, map[string]string{
+		"registry.terraform.io/hashicorp/azurerm": "3.116.0",
+		"registry.terraform.io/azure/azapi":       "1.5.0",
+	})
+	changes := map[string]*tfjson.ResourceChange{
+		"azurerm_resource_group.this": {
+			ProviderName: "registry.terraform.io/hashicorp/azurerm",
+			Change:       &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}},
+		},
+		"azurerm_virtual_network.this": {
+			ProviderName: "registry.terraform.io/hashicorp/azurerm",
+			Change: &tfjson.Change{
+				Actions:      tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate},
+				ReplacePaths: []interface{}{[]interface{}{"address_space"}},
+			},
+		},
+		"azapi_resource.this": {
+			ProviderName: "registry.terraform.io/azure/azapi",
+			Change:       &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}},
+		},
+		"azurerm_subnet.this": {
+			ProviderName: "registry.terraform.io/hashicorp/azurerm",
+			Change:       &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}},
+		},
+	}
+	verdict, err := ChangePolicy{}.verdict(changes, map[string]string{
+		"azurerm_virtual_network.this": "replace_because_cannot_update",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `registry.terraform.io/azure/azapi 1.5.0 (not upgraded):
+  azapi_resource.this: update
+registry.terraform.io/hashicorp/azurerm 3.40.0 -> 3.116.0:
+  azurerm_resource_group.this: update
+  azurerm_virtual_network.this: replace (delete, create) because replace_because_cannot_update, replace paths [["address_space"]]
+`, providerUpgradeReport(bumps, verdict))
+}
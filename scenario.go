@@ -0,0 +1,316 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmetb/go-linq/v3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultScenarioModuleRoot = "../.."
+const scenarioFileName = "test.yaml"
+
+// Scenario describes an end-to-end test declaratively, it's usually stored as `test.yaml` in the example's folder:
+//
+//	module_root: ../..
+//	vars:
+//	  location: eastus
+//	var_files:
+//	  - test.tfvars
+//	env:
+//	  ARM_USE_MSI: "true"
+//	outputs:
+//	  resource_id:
+//	    regex: "^/subscriptions/.+"
+//	  tags:
+//	    json_path: $.env
+//	    equals: dev
+//	  deleted_at:
+//	    is_null: true
+//	plan_actions:
+//	  azurerm_resource_group.this: [create]
+//	idempotency_ignores:
+//	  - ^module\.aks\.azapi_update_resource\.
+//	idempotency_allowed: [update]
+//	timeout: 90m
+//	resource_class: aks
+//
+// ModuleRoot is relative to the scenario file's folder, VarFiles are relative to the example's folder.
+type Scenario struct {
+	ModuleRoot          string                       `yaml:"module_root"`
+	Vars                map[string]interface{}       `yaml:"vars"`
+	VarFiles            []string                     `yaml:"var_files"`
+	Env                 map[string]string            `yaml:"env"`
+	Outputs             map[string]OutputExpectation `yaml:"outputs"`
+	PlanActions         map[string][]string          `yaml:"plan_actions"`
+	IdempotentIgnores   []string                     `yaml:"idempotency_ignores"`
+	IdempotentAllowed   []ChangeKind                 `yaml:"idempotency_allowed"`
+	SkipIdempotentCheck bool                         `yaml:"skip_idempotent_check"`
+	Timeout             string                       `yaml:"timeout"`
+	Weight              int                          `yaml:"weight"`
+	ResourceClass       string                       `yaml:"resource_class"`
+}
+
+// OutputExpectation asserts an output's value. When JSONPath is set, the expectations apply to the value it selects.
+// JSONPath supports `$`, `.name`, `['name']` and `[index]` segments.
+// `equals: null` can't be told from no `equals`, use IsNull to assert the value is null, or not null when it's false.
+type OutputExpectation struct {
+	Equals   interface{} `yaml:"equals"`
+	IsNull   *bool       `yaml:"is_null"`
+	Regex    string      `yaml:"regex"`
+	JSONPath string      `yaml:"json_path"`
+}
+
+func RunScenarioFile(t *testing.T, scenarioFilePath string) {
+	scenario, err := LoadScenario(scenarioFilePath)
+	require.NoError(t, err)
+	moduleRoot, exampleRelativePath, err := scenario.paths(scenarioFilePath)
+	require.NoError(t, err)
+	runScenario(t, scenario, moduleRoot, exampleRelativePath)
+}
+
+func runScenario(t *testing.T, scenario *Scenario, moduleRoot, exampleRelativePath string) {
+	testOption, err := scenario.TestOptions()
+	require.NoError(t, err)
+	RunE2ETestWithOption(t, moduleRoot, exampleRelativePath, testOption)
+}
+
+func LoadScenario(scenarioFilePath string) (*Scenario, error) {
+	content, err := os.ReadFile(filepath.Clean(scenarioFilePath))
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(s); err != nil {
+		return nil, fmt.Errorf("cannot parse scenario file %s: %s", scenarioFilePath, err.Error())
+	}
+	return s, nil
+}
+
+func (s *Scenario) TestOptions() (TestOptions, error) {
+	var timeout time.Duration
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return TestOptions{}, fmt.Errorf("invalid timeout %s: %s", s.Timeout, err.Error())
+		}
+	}
+	for _, ignore := range s.IdempotentIgnores {
+		if _, err := regexp.Compile(ignore); err != nil {
+			return TestOptions{}, fmt.Errorf("invalid idempotency ignore %s: %s", ignore, err.Error())
+		}
+	}
+	for _, kind := range s.IdempotentAllowed {
+		if !linq.From(changeKinds).Contains(kind) {
+			return TestOptions{}, fmt.Errorf("invalid idempotency allowed change kind %s, expect one of %v", kind, changeKinds)
+		}
+	}
+	for name, expectation := range s.Outputs {
+		if _, err := regexp.Compile(expectation.Regex); err != nil {
+			return TestOptions{}, fmt.Errorf("invalid regex for output %s: %s", name, err.Error())
+		}
+	}
+	testOption := TestOptions{
+		TerraformOptions: terraform.Options{
+			Upgrade:  true,
+			Vars:     s.Vars,
+			VarFiles: s.VarFiles,
+			EnvVars:  s.Env,
+		},
+		SkipIdempotentCheck: s.SkipIdempotentCheck,
+		IdempotentIgnores:   s.IdempotentIgnores,
+		IdempotentPolicy:    ChangePolicy{Allowed: s.IdempotentAllowed},
+		Timeout:             timeout,
+		Weight:              s.Weight,
+		ResourceClass:       s.ResourceClass,
+	}
+	if len(s.Outputs) > 0 {
+		testOption.Assertion = func(t *testing.T, output TerraformOutput) {
+			require.NoError(t, s.verifyOutputs(output))
+		}
+	}
+	if len(s.PlanActions) > 0 {
+		testOption.PlanAssertion = func(t *testing.T, plan *terraform.PlanStruct) {
+			require.NoError(t, s.verifyPlanActions(plan))
+		}
+	}
+	return testOption, nil
+}
+
+func (s *Scenario) paths(scenarioFilePath string) (string, string, error) {
+	exampleDir, err := filepath.Abs(filepath.Dir(scenarioFilePath))
+	if err != nil {
+		return "", "", err
+	}
+	moduleRoot := s.ModuleRoot
+	if moduleRoot == "" {
+		moduleRoot = defaultScenarioModuleRoot
+	}
+	if !filepath.IsAbs(moduleRoot) {
+		moduleRoot = filepath.Join(exampleDir, moduleRoot)
+	}
+	exampleRelativePath, err := filepath.Rel(moduleRoot, exampleDir)
+	if err != nil {
+		return "", "", err
+	}
+	if strings.HasPrefix(exampleRelativePath, "..") {
+		return "", "", fmt.Errorf("example %s is not inside module root %s", exampleDir, moduleRoot)
+	}
+	return moduleRoot, filepath.ToSlash(exampleRelativePath), nil
+}
+
+func (s *Scenario) verifyOutputs(output TerraformOutput) error {
+	var errs []string
+	for _, name := range sortedKeys(s.Outputs) {
+		value, ok := output[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("output %s not found", name))
+			continue
+		}
+		if err := s.Outputs[name].verify(value); err != nil {
+			errs = append(errs, fmt.Sprintf("output %s: %s", name, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (e OutputExpectation) verify(value interface{}) error {
+	if e.JSONPath != "" {
+		var err error
+		if value, err = jsonPathLookup(value, e.JSONPath); err != nil {
+			return err
+		}
+	}
+	if e.IsNull != nil && *e.IsNull != (value == nil) {
+		if *e.IsNull {
+			return fmt.Errorf("expected null, got %v", value)
+		}
+		return fmt.Errorf("expected not null, got null")
+	}
+	if e.Equals != nil {
+		expected, err := normalizeJson(e.Equals)
+		if err != nil {
+			return err
+		}
+		actual, err := normalizeJson(value)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			return fmt.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+	if e.Regex != "" {
+		str, ok := value.(string)
+		if !ok {
+			c, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			str = string(c)
+		}
+		matched, err := regexp.MatchString(e.Regex, str)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return fmt.Errorf("%s does not match %s", str, e.Regex)
+		}
+	}
+	return nil
+}
+
+func (s *Scenario) verifyPlanActions(plan *terraform.PlanStruct) error {
+	var errs []string
+	for _, address := range sortedKeys(s.PlanActions) {
+		expected := s.PlanActions[address]
+		change, ok := plan.ResourceChangesMap[address]
+		if !ok || change.Change == nil {
+			errs = append(errs, fmt.Sprintf("%s: expected %v, but it's not in the plan", address, expected))
+			continue
+		}
+		var actual []string
+		for _, action := range change.Change.Actions {
+			actual = append(actual, string(action))
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			errs = append(errs, fmt.Sprintf("%s: expected %v, got %v", address, expected, actual))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// normalizeJson makes values decoded from yaml comparable with values decoded from terraform output's json.
+func normalizeJson(v interface{}) (interface{}, error) {
+	c, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var r interface{}
+	err = json.Unmarshal(c, &r)
+	return r, err
+}
+
+var jsonPathSegment = regexp.MustCompile(`^(?:\.([^.\[]+)|\['([^']*)'\]|\[(\d+)\])`)
+
+func jsonPathLookup(value interface{}, path string) (interface{}, error) {
+	rest := strings.TrimPrefix(path, "$")
+	current, err := normalizeJson(value)
+	if err != nil {
+		return nil, err
+	}
+	for rest != "" {
+		m := jsonPathSegment.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid json path %s at %s", path, rest)
+		}
+		rest = rest[len(m[0]):]
+		if m[3] != "" {
+			index, _ := strconv.Atoi(m[3])
+			list, ok := current.([]interface{})
+			if !ok || index >= len(list) {
+				return nil, fmt.Errorf("json path %s: index %d not found", path, index)
+			}
+			current = list[index]
+			continue
+		}
+		key := m[1] + m[2]
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("json path %s: key %s not found", path, key)
+		}
+		if current, ok = obj[key]; !ok {
+			return nil, fmt.Errorf("json path %s: key %s not found", path, key)
+		}
+	}
+	return current, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,162 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunScenarioFile(t *testing.T) {
+	RunScenarioFile(t, "example/basic/test.yaml")
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := writeScenario(t, `
+vars:
+  number: 1
+var_files:
+  - test.tfvars
+env:
+  TEST_ENV: "1"
+outputs:
+  id:
+    regex: ^\d+$
+plan_actions:
+  null_resource.test: [create]
+idempotency_ignores:
+  - ^null_resource\.
+idempotency_allowed: [update]
+timeout: 10m
+`)
+	s, err := LoadScenario(path)
+	require.NoError(t, err)
+	opts, err := s.TestOptions()
+	require.NoError(t, err)
+	assert.Equal(t, 1, opts.TerraformOptions.Vars["number"])
+	assert.Equal(t, []string{"test.tfvars"}, opts.TerraformOptions.VarFiles)
+	assert.Equal(t, "1", opts.TerraformOptions.EnvVars["TEST_ENV"])
+	assert.Equal(t, []string{`^null_resource\.`}, opts.IdempotentIgnores)
+	assert.Equal(t, []ChangeKind{ChangeUpdate}, opts.IdempotentPolicy.Allowed)
+	assert.Equal(t, 10*time.Minute, opts.Timeout)
+	assert.NotNil(t, opts.Assertion)
+	assert.NotNil(t, opts.PlanAssertion)
+}
+
+func TestLoadScenario_unknownFieldShouldFail(t *testing.T) {
+	path := writeScenario(t, `
+output:
+  id:
+    regex: ^\d+$
+`)
+	_, err := LoadScenario(path)
+	assert.NotNil(t, err)
+}
+
+func TestScenarioTestOptions_invalidTimeout(t *testing.T) {
+	s := Scenario{Timeout: "ten minutes"}
+	_, err := s.TestOptions()
+	assert.NotNil(t, err)
+}
+
+func TestScenarioTestOptions_invalidIdempotentAllowed(t *testing.T) {
+	s := Scenario{IdempotentAllowed: []ChangeKind{"updates"}}
+	_, err := s.TestOptions()
+	assert.NotNil(t, err)
+}
+
+func TestScenarioPaths(t *testing.T) {
+	s := Scenario{}
+	root, example, err := s.paths(filepath.Join("example", "basic", "test.yaml"))
+	require.NoError(t, err)
+	expectedRoot, err := filepath.Abs(".")
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, root)
+	assert.Equal(t, "example/basic", example)
+}
+
+func TestScenarioPaths_exampleOutsideModuleRoot(t *testing.T) {
+	s := Scenario{ModuleRoot: "../basic"}
+	_, _, err := s.paths(filepath.Join("example", "upgrade", "test.yaml"))
+	assert.NotNil(t, err)
+}
+
+func TestOutputExpectation(t *testing.T) {
+	output := map[string]interface{}{
+		"tags": map[string]interface{}{
+			"env": "dev",
+		},
+		"ids":        []interface{}{"a", "b"},
+		"count":      float64(2),
+		"deleted_at": nil,
+	}
+	isNull, notNull := true, false
+	cases := []struct {
+		name        string
+		expectation OutputExpectation
+		value       interface{}
+		success     bool
+	}{
+		{name: "equals number", expectation: OutputExpectation{Equals: 2}, value: output["count"], success: true},
+		{name: "equals mismatch", expectation: OutputExpectation{Equals: 3}, value: output["count"], success: false},
+		{name: "equals object", expectation: OutputExpectation{Equals: map[string]interface{}{"env": "dev"}}, value: output["tags"], success: true},
+		{name: "regex", expectation: OutputExpectation{Regex: "^d"}, value: "dev", success: true},
+		{name: "regex mismatch", expectation: OutputExpectation{Regex: "^p"}, value: "dev", success: false},
+		{name: "json path key", expectation: OutputExpectation{JSONPath: "$.tags.env", Equals: "dev"}, value: output, success: true},
+		{name: "json path bracket key", expectation: OutputExpectation{JSONPath: "$['tags']['env']", Regex: "^dev$"}, value: output, success: true},
+		{name: "json path index", expectation: OutputExpectation{JSONPath: "$.ids[1]", Equals: "b"}, value: output, success: true},
+		{name: "json path index out of range", expectation: OutputExpectation{JSONPath: "$.ids[2]"}, value: output, success: false},
+		{name: "json path missing key", expectation: OutputExpectation{JSONPath: "$.tags.owner"}, value: output, success: false},
+		{name: "is null", expectation: OutputExpectation{IsNull: &isNull}, value: output["deleted_at"], success: true},
+		{name: "is null mismatch", expectation: OutputExpectation{IsNull: &isNull}, value: output["count"], success: false},
+		{name: "is not null", expectation: OutputExpectation{IsNull: &notNull}, value: output["count"], success: true},
+		{name: "is not null mismatch", expectation: OutputExpectation{IsNull: &notNull}, value: output["deleted_at"], success: false},
+		{name: "json path is null", expectation: OutputExpectation{JSONPath: "$.deleted_at", IsNull: &isNull}, value: output, success: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.expectation.verify(c.value)
+			assert.Equal(t, c.success, err == nil)
+		})
+	}
+}
+
+func TestScenarioVerifyOutputs_missingOutput(t *testing.T) {
+	s := Scenario{Outputs: map[string]OutputExpectation{
+		"id": {Regex: ".*"},
+	}}
+	err := s.verifyOutputs(TerraformOutput{})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "output id not found")
+}
+
+func TestScenarioVerifyPlanActions(t *testing.T) {
+	plan := &terraform.PlanStruct{
+		ResourceChangesMap: map[string]*tfjson.ResourceChange{
+			"null_resource.test": {
+				Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}},
+			},
+		},
+	}
+	s := Scenario{PlanActions: map[string][]string{
+		"null_resource.test": {"create"},
+	}}
+	assert.NoError(t, s.verifyPlanActions(plan))
+	s.PlanActions["null_resource.test"] = []string{"update"}
+	assert.NotNil(t, s.verifyPlanActions(plan))
+	s.PlanActions = map[string][]string{
+		"null_resource.missing": {"create"},
+	}
+	assert.NotNil(t, s.verifyPlanActions(plan))
+}
+
+func writeScenario(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
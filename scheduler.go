@@ -0,0 +1,224 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+)
+
+const (
+	schedulerCapacityEnv        = "TEST_CONCURRENCY_CAPACITY"
+	schedulerResourceClassesEnv = "TEST_RESOURCE_CLASSES"
+	defaultTestWeight           = 1
+	schedulerSlotsFolder        = "capacity"
+)
+
+var (
+	schedulerMu sync.Mutex
+	scheduler   = newSchedulerFromEnv()
+)
+
+// Scheduler limits the total weight of tests that hold resources at once. A test acquires its weight before apply and releases it after destroy.
+// Waiting tests are served in order, so a heavy test won't be starved by light ones.
+// The weight is also held as Capacity slots of OS file locks under Dir, so test processes sharing the folder, like the packages of `go test ./...`, share the Capacity.
+// They should be configured with the same Capacity.
+type Scheduler struct {
+	// Capacity is the total weight allowed at once, zero means unlimited.
+	Capacity int
+	// Classes maps resource class names to weights, like `{"small": 1, "aks": 4}`.
+	Classes map[string]int
+	// Dir is the lock folder shared with other test processes, default to `TEST_LOCK_DIR`, or `terraform-module-test-helper/locks` in the system temp folder.
+	Dir string
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	used    int
+	queue   []int64
+	nextId  int64
+	inUse   map[int64]int
+	initErr error
+}
+
+// ConfigureScheduler replaces the scheduler shared by all tests in this process, tests that already hold capacity release it to the replaced scheduler.
+// By default the capacity is read from `TEST_CONCURRENCY_CAPACITY`, and the classes from `TEST_RESOURCE_CLASSES` like `small=1,aks=4`.
+func ConfigureScheduler(capacity int, classes map[string]int) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	scheduler = &Scheduler{Capacity: capacity, Classes: classes}
+}
+
+func currentScheduler() *Scheduler {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	return scheduler
+}
+
+func newSchedulerFromEnv() *Scheduler {
+	s := &Scheduler{}
+	if v := os.Getenv(schedulerCapacityEnv); v != "" {
+		capacity, err := strconv.Atoi(v)
+		if err != nil || capacity < 0 {
+			s.initErr = fmt.Errorf("invalid %s %q, must be a non-negative integer", schedulerCapacityEnv, v)
+			return s
+		}
+		s.Capacity = capacity
+	}
+	if v := os.Getenv(schedulerResourceClassesEnv); v != "" {
+		classes, err := parseResourceClasses(v)
+		if err != nil {
+			s.initErr = fmt.Errorf("invalid %s %q: %w", schedulerResourceClassesEnv, v, err)
+			return s
+		}
+		s.Classes = classes
+	}
+	return s
+}
+
+func parseResourceClasses(v string) (map[string]int, error) {
+	classes := make(map[string]int)
+	for _, pair := range strings.Split(v, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expect name=weight, got %q", pair)
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("weight of %s must be a positive integer, got %q", name, weight)
+		}
+		classes[strings.TrimSpace(name)] = w
+	}
+	return classes, nil
+}
+
+// weight resolves a test's weight, an explicit weight wins over the resource class.
+func (s *Scheduler) weight(weight int, class string) (int, error) {
+	if weight > 0 {
+		return weight, nil
+	}
+	if class == "" {
+		return defaultTestWeight, nil
+	}
+	w, ok := s.Classes[class]
+	if !ok {
+		return 0, fmt.Errorf("unknown resource class %q, known classes: %s", class, strings.Join(sortedKeys(s.Classes), ", "))
+	}
+	return w, nil
+}
+
+// acquire blocks until the test's weight fits in the capacity, and returns the release function and how long it waited.
+func (s *Scheduler) acquire(t testingT, weight int, class string) (func(), time.Duration, error) {
+	if s.initErr != nil {
+		return nil, 0, s.initErr
+	}
+	w, err := s.weight(weight, class)
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.Capacity == 0 {
+		return func() {}, 0, nil
+	}
+	if w > s.Capacity {
+		logger.Log(t, fmt.Sprintf("===> weight %d exceeds capacity %d, the test would run alone", w, s.Capacity))
+		w = s.Capacity
+	}
+	start := time.Now()
+	s.mu.Lock()
+	if s.cond == nil {
+		s.cond = sync.NewCond(&s.mu)
+		s.inUse = make(map[int64]int)
+	}
+	id := s.nextId
+	s.nextId++
+	s.queue = append(s.queue, id)
+	logged := false
+	for s.queue[0] != id || s.used+w > s.Capacity {
+		if !logged {
+			logger.Log(t, fmt.Sprintf("===> waiting for capacity, need %d, %d of %d in use, %d tests ahead", w, s.used, s.Capacity, s.position(id)))
+			logged = true
+		}
+		s.cond.Wait()
+	}
+	s.used += w
+	s.inUse[id] = w
+	s.mu.Unlock()
+	// the test stays at the head of the queue while waiting for other processes, so the order within the process is kept
+	releaseSlots, slotsLogged := s.acquireSlots(t, w)
+	s.mu.Lock()
+	s.queue = s.queue[1:]
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	waited := time.Since(start)
+	if logged || slotsLogged {
+		logger.Log(t, fmt.Sprintf("===> waited %s for capacity", waited.Round(time.Second)))
+	}
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			releaseSlots()
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.used -= s.inUse[id]
+			delete(s.inUse, id)
+			s.cond.Broadcast()
+		})
+	}, waited, nil
+}
+
+// acquireSlots holds w of the Capacity slot locks under Dir, and returns the release function and whether it logged waiting for other processes.
+// Slots are only collected under the queue lock, so two processes never deadlock by each holding part of the slots the other needs.
+// When the locks cannot be taken, like an unwritable Dir, the capacity is only counted within the process.
+func (s *Scheduler) acquireSlots(t testingT, w int) (func(), bool) {
+	dir := filepath.Join(lockDir(s.Dir), schedulerSlotsFolder)
+	unlockQueue, err := newFileLock(filepath.Join(dir, "queue.lock")).Lock()
+	if err != nil {
+		logger.Log(t, fmt.Sprintf("===> cannot share capacity with other test processes, only counting it within this process: %s", err.Error()))
+		return func() {}, false
+	}
+	defer unlockQueue()
+	held := make(map[int]func())
+	release := func() {
+		for _, unlock := range held {
+			unlock()
+		}
+	}
+	logged := false
+	for {
+		for i := 0; i < s.Capacity && len(held) < w; i++ {
+			if _, ok := held[i]; ok {
+				continue
+			}
+			unlock, ok, err := newFileLock(filepath.Join(dir, fmt.Sprintf("slot-%d.lock", i))).tryLock()
+			if err != nil {
+				release()
+				logger.Log(t, fmt.Sprintf("===> cannot share capacity with other test processes, only counting it within this process: %s", err.Error()))
+				return func() {}, logged
+			}
+			if ok {
+				held[i] = unlock
+			}
+		}
+		if len(held) == w {
+			return release, logged
+		}
+		if !logged {
+			logger.Log(t, fmt.Sprintf("===> waiting for capacity held by other test processes, need %d, %d of %d free", w, len(held), s.Capacity))
+			logged = true
+		}
+		time.Sleep(fileLockRetryInterval)
+	}
+}
+
+func (s *Scheduler) position(id int64) int {
+	for i, queued := range s.queue {
+		if queued == id {
+			return i
+		}
+	}
+	return -1
+}
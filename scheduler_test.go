@@ -0,0 +1,164 @@
+package terraform_module_test_helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_unlimitedByDefault(t *testing.T) {
+	s := &Scheduler{}
+	release, waited, err := s.acquire(newT(t), 100, "")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), waited)
+	release()
+}
+
+func TestScheduler_waitForCapacity(t *testing.T) {
+	s := &Scheduler{Capacity: 3, Classes: map[string]int{"aks": 2}, Dir: t.TempDir()}
+	release1, _, err := s.acquire(newT(t), 0, "aks")
+	require.NoError(t, err)
+	release2, _, err := s.acquire(newT(t), 0, "")
+	require.NoError(t, err)
+	acquired := make(chan time.Duration)
+	go func() {
+		release, waited, err := s.acquire(newT(t), 0, "aks")
+		assert.NoError(t, err)
+		acquired <- waited
+		release()
+	}()
+	select {
+	case <-acquired:
+		assert.FailNow(t, "should wait for capacity")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release2()
+	select {
+	case <-acquired:
+		assert.FailNow(t, "one released weight is not enough")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release1()
+	release1()
+	select {
+	case waited := <-acquired:
+		assert.Greater(t, waited, 100*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "should acquire after release")
+	}
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.used == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestScheduler_heavyTestShouldNotBeStarved(t *testing.T) {
+	s := &Scheduler{Capacity: 2, Dir: t.TempDir()}
+	release1, _, err := s.acquire(newT(t), 1, "")
+	require.NoError(t, err)
+	heavy := make(chan func())
+	go func() {
+		release, _, err := s.acquire(newT(t), 2, "")
+		assert.NoError(t, err)
+		heavy <- release
+	}()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queue) == 1
+	}, time.Second, 10*time.Millisecond)
+	light := make(chan func())
+	go func() {
+		release, _, err := s.acquire(newT(t), 1, "")
+		assert.NoError(t, err)
+		light <- release
+	}()
+	select {
+	case <-light:
+		assert.FailNow(t, "light test should wait behind the heavy one")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release1()
+	releaseHeavy := <-heavy
+	releaseHeavy()
+	releaseLight := <-light
+	releaseLight()
+}
+
+func TestScheduler_weightExceedsCapacityRunsAlone(t *testing.T) {
+	s := &Scheduler{Capacity: 2, Dir: t.TempDir()}
+	release, _, err := s.acquire(newT(t), 5, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.used)
+	release()
+}
+
+func TestScheduler_capacityIsSharedAcrossSchedulersOfTheSameDir(t *testing.T) {
+	dir := t.TempDir()
+	s1 := &Scheduler{Capacity: 3, Dir: dir}
+	s2 := &Scheduler{Capacity: 3, Dir: dir}
+	release1, _, err := s1.acquire(newT(t), 2, "")
+	require.NoError(t, err)
+	acquired := make(chan func())
+	go func() {
+		release, _, err := s2.acquire(newT(t), 2, "")
+		assert.NoError(t, err)
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		assert.FailNow(t, "should wait for capacity held by the other scheduler")
+	case <-time.After(300 * time.Millisecond):
+	}
+	release1()
+	select {
+	case release2 := <-acquired:
+		release2()
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "should acquire after the other scheduler released")
+	}
+}
+
+func TestConfigureScheduler(t *testing.T) {
+	previous := currentScheduler()
+	defer func() {
+		schedulerMu.Lock()
+		defer schedulerMu.Unlock()
+		scheduler = previous
+	}()
+	ConfigureScheduler(4, map[string]int{"aks": 2})
+	assert.Equal(t, 4, currentScheduler().Capacity)
+}
+
+func TestScheduler_unknownResourceClass(t *testing.T) {
+	s := &Scheduler{Capacity: 2, Classes: map[string]int{"small": 1}, Dir: t.TempDir()}
+	_, _, err := s.acquire(newT(t), 0, "large")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "small")
+}
+
+func TestNewSchedulerFromEnv(t *testing.T) {
+	t.Setenv(schedulerCapacityEnv, "8")
+	t.Setenv(schedulerResourceClassesEnv, "small=1, aks=4")
+	s := newSchedulerFromEnv()
+	require.NoError(t, s.initErr)
+	assert.Equal(t, 8, s.Capacity)
+	assert.Equal(t, map[string]int{"small": 1, "aks": 4}, s.Classes)
+
+	t.Setenv(schedulerResourceClassesEnv, "aks")
+	s = newSchedulerFromEnv()
+	_, _, err := s.acquire(newT(t), 1, "")
+	assert.Error(t, err)
+}
+
+func TestVersionSnapshotToString_capacityWait(t *testing.T) {
+	snapshot := TestVersionSnapshot{
+		Time:         time.Now(),
+		Success:      true,
+		CapacityWait: 90 * time.Second,
+	}
+	assert.Contains(t, snapshot.ToString(), "### Waited For Capacity\n\n1m30s\n")
+}
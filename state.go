@@ -0,0 +1,194 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+const SensitiveValueMask = "(sensitive value)"
+
+// TerraformState is the parsed output of `terraform show -json` after apply.
+// The raw state is kept unexported, so sensitive values are only read through masked accessors, or SensitiveAttribute on purpose.
+type TerraformState struct {
+	state *tfjson.State
+}
+
+// StateResource is a resource in TerraformState, its attributes are read by Attribute with sensitive values masked.
+type StateResource struct {
+	resource *tfjson.StateResource
+}
+
+func showState(t terratest.TestingT, option terraform.Options) (*TerraformState, error) {
+	option.PlanFilePath = ""
+	output, err := terraform.ShowE(t, removeLogger(option))
+	if err != nil {
+		return nil, err
+	}
+	state := &tfjson.State{}
+	if err = json.Unmarshal([]byte(output), state); err != nil {
+		return nil, err
+	}
+	return &TerraformState{state: state}, nil
+}
+
+// TerraformVersion returns the version of Terraform that wrote the state.
+func (s *TerraformState) TerraformVersion() string {
+	if s.state == nil {
+		return ""
+	}
+	return s.state.TerraformVersion
+}
+
+// Output returns the value of the root module's output, sensitive outputs are masked as SensitiveValueMask.
+func (s *TerraformState) Output(name string) (interface{}, error) {
+	if s.state == nil || s.state.Values == nil || s.state.Values.Outputs[name] == nil {
+		return nil, fmt.Errorf("cannot find output %s", name)
+	}
+	output := s.state.Values.Outputs[name]
+	if output.Sensitive {
+		return SensitiveValueMask, nil
+	}
+	return normalizeJson(output.Value)
+}
+
+// Resources returns all managed and data resources, including resources in child modules.
+func (s *TerraformState) Resources() []*StateResource {
+	if s.state == nil || s.state.Values == nil {
+		return nil
+	}
+	return moduleResources(s.state.Values.RootModule)
+}
+
+func moduleResources(m *tfjson.StateModule) []*StateResource {
+	if m == nil {
+		return nil
+	}
+	var r []*StateResource
+	for _, res := range m.Resources {
+		r = append(r, &StateResource{resource: res})
+	}
+	for _, child := range m.ChildModules {
+		r = append(r, moduleResources(child)...)
+	}
+	return r
+}
+
+// Resource returns the resource with the given absolute address, eg: `module.vnet.azurerm_subnet.this["a"]`, or nil when it's not in state.
+func (s *TerraformState) Resource(address string) *StateResource {
+	for _, r := range s.Resources() {
+		if r.Address() == address {
+			return r
+		}
+	}
+	return nil
+}
+
+// ResourcesByType returns all resources with the given type, eg: `azurerm_subnet`.
+func (s *TerraformState) ResourcesByType(resourceType string) []*StateResource {
+	var result []*StateResource
+	for _, r := range s.Resources() {
+		if r.Type() == resourceType {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Address returns the absolute address of the resource, eg: `module.vnet.azurerm_subnet.this[0]`.
+func (r *StateResource) Address() string {
+	return r.resource.Address
+}
+
+// Mode returns `managed` or `data`.
+func (r *StateResource) Mode() string {
+	return string(r.resource.Mode)
+}
+
+// Type returns the resource type, eg: `azurerm_subnet`.
+func (r *StateResource) Type() string {
+	return r.resource.Type
+}
+
+// Name returns the resource name without index, eg: `this`.
+func (r *StateResource) Name() string {
+	return r.resource.Name
+}
+
+// Index returns the `count` or `for_each` index, nil when the resource has neither.
+func (r *StateResource) Index() interface{} {
+	return r.resource.Index
+}
+
+// ProviderName returns the provider's address, eg: `registry.terraform.io/hashicorp/azurerm`.
+func (r *StateResource) ProviderName() string {
+	return r.resource.ProviderName
+}
+
+// Attribute reads an attribute by path, eg: `tags.env` or `ip_configuration[0].name`. Sensitive values are masked as SensitiveValueMask.
+func (r *StateResource) Attribute(path string) (interface{}, error) {
+	values, err := r.maskedAttributeValues()
+	if err != nil {
+		return nil, err
+	}
+	return attributeLookup(values, path)
+}
+
+// SensitiveAttribute reads an attribute by path like Attribute, without masking sensitive values.
+func (r *StateResource) SensitiveAttribute(path string) (interface{}, error) {
+	return attributeLookup(r.resource.AttributeValues, path)
+}
+
+func (r *StateResource) maskedAttributeValues() (interface{}, error) {
+	values, err := normalizeJson(r.resource.AttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.resource.SensitiveValues) == 0 {
+		return values, nil
+	}
+	var sensitive interface{}
+	if err = json.Unmarshal(r.resource.SensitiveValues, &sensitive); err != nil {
+		return nil, err
+	}
+	return mask(values, sensitive), nil
+}
+
+// mask replaces values marked as `true` in terraform's `sensitive_values` structure.
+func mask(value interface{}, sensitive interface{}) interface{} {
+	switch s := sensitive.(type) {
+	case bool:
+		if s {
+			return SensitiveValueMask
+		}
+	case map[string]interface{}:
+		if obj, ok := value.(map[string]interface{}); ok {
+			for k, v := range obj {
+				obj[k] = mask(v, s[k])
+			}
+		}
+	case []interface{}:
+		if list, ok := value.([]interface{}); ok {
+			for i := range list {
+				if i < len(s) {
+					list[i] = mask(list[i], s[i])
+				}
+			}
+		}
+	}
+	return value
+}
+
+func attributeLookup(values interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty attribute path")
+	}
+	if !strings.HasPrefix(path, "$") && !strings.HasPrefix(path, "[") {
+		path = "." + path
+	}
+	return jsonPathLookup(values, path)
+}
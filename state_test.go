@@ -0,0 +1,158 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stateJson = `
+{
+  "format_version": "1.0",
+  "terraform_version": "1.9.0",
+  "values": {
+    "outputs": {
+      "name": {
+        "sensitive": false,
+        "value": "subnet0",
+        "type": "string"
+      },
+      "password": {
+        "sensitive": true,
+        "value": "secret",
+        "type": "string"
+      }
+    },
+    "root_module": {
+      "resources": [
+        {
+          "address": "random_password.this",
+          "mode": "managed",
+          "type": "random_password",
+          "name": "this",
+          "provider_name": "registry.terraform.io/hashicorp/random",
+          "values": {
+            "length": 10,
+            "result": "secret",
+            "keepers": {
+              "a": "b"
+            }
+          },
+          "sensitive_values": {
+            "keepers": {},
+            "result": true
+          }
+        }
+      ],
+      "child_modules": [
+        {
+          "address": "module.vnet",
+          "resources": [
+            {
+              "address": "module.vnet.azurerm_subnet.this[0]",
+              "mode": "managed",
+              "type": "azurerm_subnet",
+              "name": "this",
+              "index": 0,
+              "provider_name": "registry.terraform.io/hashicorp/azurerm",
+              "values": {
+                "name": "subnet0",
+                "address_prefixes": ["10.0.0.0/24"]
+              },
+              "sensitive_values": {
+                "address_prefixes": [false]
+              }
+            },
+            {
+              "address": "module.vnet.azurerm_subnet.this[1]",
+              "mode": "managed",
+              "type": "azurerm_subnet",
+              "name": "this",
+              "index": 1,
+              "provider_name": "registry.terraform.io/hashicorp/azurerm",
+              "values": {
+                "name": "subnet1",
+                "address_prefixes": ["10.0.1.0/24"]
+              }
+            }
+          ]
+        }
+      ]
+    }
+  }
+}
+`
+
+func TestE2EExampleTest_stateAssertion(t *testing.T) {
+	RunE2ETestWithOption(t, "./", "example/basic", TestOptions{
+		TerraformOptions: terraform.Options{
+			Upgrade: true,
+		},
+		StateAssertion: func(t *testing.T, output TerraformOutput, state *TerraformState) {
+			r := state.Resource("null_resource.test")
+			require.NotNil(t, r)
+			id, err := r.Attribute("id")
+			require.NoError(t, err)
+			assert.Equal(t, output["resource_id"], id)
+		},
+	})
+}
+
+func TestTerraformState_queries(t *testing.T) {
+	state := parseTestState(t)
+	assert.Len(t, state.Resources(), 3)
+	subnet := state.Resource("module.vnet.azurerm_subnet.this[1]")
+	require.NotNil(t, subnet)
+	name, err := subnet.Attribute("name")
+	require.NoError(t, err)
+	assert.Equal(t, "subnet1", name)
+	prefix, err := subnet.Attribute("address_prefixes[0]")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", prefix)
+	assert.Len(t, state.ResourcesByType("azurerm_subnet"), 2)
+	assert.Nil(t, state.Resource("azurerm_subnet.not_exist"))
+	_, err = subnet.Attribute("not_exist")
+	assert.NotNil(t, err)
+	assert.Equal(t, "azurerm_subnet", subnet.Type())
+	assert.Equal(t, "this", subnet.Name())
+	assert.Equal(t, "managed", subnet.Mode())
+	assert.Equal(t, float64(1), subnet.Index())
+	assert.Equal(t, "registry.terraform.io/hashicorp/azurerm", subnet.ProviderName())
+	assert.Equal(t, "1.9.0", state.TerraformVersion())
+}
+
+func TestTerraformState_sensitiveValueShouldBeMasked(t *testing.T) {
+	state := parseTestState(t)
+	password := state.Resource("random_password.this")
+	require.NotNil(t, password)
+	masked, err := password.Attribute("result")
+	require.NoError(t, err)
+	assert.Equal(t, SensitiveValueMask, masked)
+	keeper, err := password.Attribute("keepers.a")
+	require.NoError(t, err)
+	assert.Equal(t, "b", keeper)
+	result, err := password.SensitiveAttribute("result")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", result)
+	masked, err = password.Attribute("result")
+	require.NoError(t, err)
+	assert.Equal(t, SensitiveValueMask, masked, "masking should not modify the original values")
+	output, err := state.Output("password")
+	require.NoError(t, err)
+	assert.Equal(t, SensitiveValueMask, output)
+	output, err = state.Output("name")
+	require.NoError(t, err)
+	assert.Equal(t, "subnet0", output)
+	_, err = state.Output("not_exist")
+	assert.Error(t, err)
+}
+
+func parseTestState(t *testing.T) *TerraformState {
+	s := &tfjson.State{}
+	require.NoError(t, json.Unmarshal([]byte(stateJson), s))
+	return &TerraformState{state: s}
+}
@@ -0,0 +1,102 @@
+package terraform_module_test_helper
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/thanhpk/randstr"
+)
+
+const templateFileSuffix = ".tplt"
+
+// renderTemplates renders every `*.tplt` file under the workspace into the file without the suffix, like `override.tf.tplt` into `override.tf`, before init.
+// Templates use Go's text/template syntax with these functions:
+//
+//   - `env "NAME"`: the environment variable, the options' EnvVars win over the process's environment.
+//   - `default "value" x`: x, or "value" when x is empty, usually piped like `{{env "MODULE_SOURCE" | default "../.."}}`.
+//   - `vars "name"`: the options' Vars, it's an error when the variable is not set.
+//   - `testName`: the name of the running test.
+//   - `randomSuffix`: a random lowercase hex string, the same for all templates in the workspace.
+//
+// Errors name the template and its line, like `template: override.tf.tplt:2: function "envs" not defined`.
+func renderTemplates(t terratest.TestingT, options terraform.Options) error {
+	functions := templateFunctions(t.Name(), options)
+	return filepath.WalkDir(options.TerraformDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != options.TerraformDir && (d.Name() == ".terraform" || d.Name() == isolatedEnvFolder) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), templateFileSuffix) {
+			return nil
+		}
+		name, err := filepath.Rel(options.TerraformDir, path)
+		if err != nil {
+			return err
+		}
+		return renderTemplate(path, filepath.ToSlash(name), functions)
+	})
+}
+
+func renderTemplate(path, name string, functions template.FuncMap) error {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	tplt, err := template.New(name).Funcs(functions).Parse(string(content))
+	if err != nil {
+		return err
+	}
+	var rendered bytes.Buffer
+	if err = tplt.Execute(&rendered, nil); err != nil {
+		return err
+	}
+	return os.WriteFile(strings.TrimSuffix(path, templateFileSuffix), rendered.Bytes(), 0600)
+}
+
+func templateFunctions(testName string, options terraform.Options) template.FuncMap {
+	suffix := randstr.Hex(8)
+	return template.FuncMap{
+		"env": func(name string) string {
+			if v, ok := options.EnvVars[name]; ok {
+				return v
+			}
+			return os.Getenv(name)
+		},
+		"default": func(d interface{}, v interface{}) interface{} {
+			if v == nil {
+				return d
+			}
+			rv := reflect.ValueOf(v)
+			if rv.IsZero() || ((rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && rv.Len() == 0) {
+				return d
+			}
+			return v
+		},
+		"vars": func(name string) (interface{}, error) {
+			v, ok := options.Vars[name]
+			if !ok {
+				return nil, fmt.Errorf("variable %s is not set", name)
+			}
+			return v, nil
+		},
+		"testName": func() string {
+			return testName
+		},
+		"randomSuffix": func() string {
+			return suffix
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nested"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf.tplt"), []byte(`locals {
+  source   = "{{env "MODULE_SOURCE" | default "../.."}}"
+  region   = "{{env "REGION" | default "eastus"}}"
+  location = "{{vars "location"}}"
+  test     = "{{testName}}"
+  name     = "rg-{{randomSuffix}}"
+}
+`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "name.txt.tplt"), []byte(`rg-{{randomSuffix}}`), 0600))
+	t.Setenv("REGION", "westus")
+	require.NoError(t, renderTemplates(t, terraform.Options{
+		TerraformDir: dir,
+		EnvVars:      map[string]string{"MODULE_SOURCE": "../../modules/x"},
+		Vars:         map[string]interface{}{"location": "eastus2"},
+	}))
+	nested, err := os.ReadFile(filepath.Join(dir, "nested", "name.txt"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^rg-[0-9a-f]{8}$`, string(nested))
+	rendered, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, `locals {
+  source   = "../../modules/x"
+  region   = "westus"
+  location = "eastus2"
+  test     = "TestRenderTemplates"
+  name     = "`+string(nested)+`"
+}
+`, string(rendered))
+}
+
+func TestRenderTemplatesErrorsNameFileAndLine(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf.tplt"), []byte("locals {\n  x = \"{{envs \"X\"}}\"\n}\n"), 0600))
+	err := renderTemplates(t, terraform.Options{TerraformDir: dir})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "main.tf.tplt:2:")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf.tplt"), []byte("locals {\n\n  x = \"{{vars \"location\"}}\"\n}\n"), 0600))
+	err = renderTemplates(t, terraform.Options{TerraformDir: dir})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "main.tf.tplt:3:")
+	assert.Contains(t, err.Error(), "variable location is not set")
+}
+
+func TestRenderExampleTemplate(t *testing.T) {
+	tmpDir := test_structure.CopyTerraformFolderToTemp(t, "./example/output_upgrade", "test")
+	require.NoError(t, renderTemplates(t, terraform.Options{TerraformDir: tmpDir}))
+	rendered, err := os.ReadFile(filepath.Join(tmpDir, "override.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(rendered), `source = "../before/"`)
+}
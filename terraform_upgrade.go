@@ -0,0 +1,130 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+)
+
+type TerraformUpgradeOptions struct {
+	// OldBinary applies the example, NewBinary plans with the same state. They're resolved like RunE2ETestMatrix's binaries.
+	OldBinary string
+	NewBinary string
+	// IdempotentIgnores are regular expressions matched against resource addresses, matched resources' changes are ignored.
+	IdempotentIgnores []string
+	// Policy decides which changes fail the test, like `ChangePolicy{Allowed: []ChangeKind{ChangeUpdate}}`, IdempotentIgnores are added to its Ignores.
+	Policy ChangePolicy
+}
+
+// TerraformUpgradeTest applies the example with an older Terraform binary, then re-inits and plans the same state with a newer binary,
+// providers stay locked by the lock file the old binary wrote, so only the CLI changes. It fails when the plan doesn't pass upgradeOpts.Policy, any change fails by default.
+// The report shows the state's format version and the Terraform version that wrote it, along with the resource changes.
+//
+//goland:noinspection GoUnusedExportedFunction
+func TerraformUpgradeTest(t *testing.T, moduleRootPath, exampleRelativePath string, opts terraform.Options, upgradeOpts TerraformUpgradeOptions) {
+	wrappedT := newT(t)
+	tryParallel(wrappedT)
+	defer coordinator.start(wrappedT)()
+	logger.Log(wrappedT, fmt.Sprintf("===> Starting Terraform upgrade test for %s, since we're running tests in parallel, the test log will be buffered and output to stdout after the test was finished.", filepath.Join(moduleRootPath, exampleRelativePath)))
+	oldBinary, err := resolveTerraformBinary(upgradeOpts.OldBinary)
+	require.NoError(wrappedT, err)
+	newBinary, err := resolveTerraformBinary(upgradeOpts.NewBinary)
+	require.NoError(wrappedT, err)
+	l := NewMemoryLogger()
+	defer func() { _ = l.Close() }()
+	opts.Logger = logger.New(l)
+	opts = setupRetryLogic(opts)
+
+	tmpDir := copyTerraformFolderToTemp(wrappedT, moduleRootPath, exampleRelativePath)
+	defer func() {
+		removeWorkspace(t, tmpDir)
+	}()
+	opts = retryableOptions(t, opts)
+	opts.TerraformDir = tmpDir
+	require.NoError(wrappedT, terraformUpgrade(wrappedT, opts, moduleRootPath, exampleRelativePath, oldBinary, newBinary, upgradeOpts.Policy.withIgnores(upgradeOpts.IdempotentIgnores)))
+}
+
+func terraformUpgrade(t *T, opts terraform.Options, moduleRootPath, exampleRelativePath, oldBinary, newBinary string, policy ChangePolicy) error {
+	report := newUpgradeReport(t, "terraform", exampleRelativePath, oldBinary)
+	return report.save(t, processModuleRoot(moduleRootPath), upgradeTerraform(t, opts, moduleRootPath, exampleRelativePath, oldBinary, newBinary, policy, report))
+}
+
+func upgradeTerraform(t *T, opts terraform.Options, moduleRootPath, exampleRelativePath, oldBinary, newBinary string, policy ChangePolicy, upgradeReport *UpgradeReport) error {
+	opts.TerraformBinary = oldBinary
+	if err := renderTemplates(t, opts); err != nil {
+		return err
+	}
+	opts, err := isolateEnv(opts)
+	if err != nil {
+		return err
+	}
+	entry := registerWorkspace(t, moduleRootPath, exampleRelativePath, opts)
+	defer func() {
+		// the new binary might have upgraded the working directory, so destroy with the binary that ran last
+		destroyTracked(t, opts, VerifyStateEmpty, entry)
+	}()
+	initAndApply(t, &opts)
+	coordinator.failIfInterrupted(t)
+	state, err := readStateVersion(filepath.Join(opts.TerraformDir, "terraform.tfstate"))
+	if err != nil {
+		return err
+	}
+	opts.TerraformBinary = newBinary
+	if err = entry.update(opts); err != nil {
+		return err
+	}
+	opts.Upgrade = false
+	opts.Logger = logger.Discard
+	plan, reasons := initAndPlanWithActionReasons(t, opts)
+	verdict, err := policy.verdict(plan.ResourceChangesMap, reasons)
+	if err != nil {
+		return err
+	}
+	upgradeReport.Baseline = state.TerraformVersion
+	upgradeReport.addHop(state.TerraformVersion, plan.RawPlan.TerraformVersion, verdict)
+	report := terraformUpgradeReport(state, plan.RawPlan.TerraformVersion, verdict)
+	logger.Log(t, fmt.Sprintf("===> Terraform upgrade report:\n%s", report))
+	if verdict.Passed {
+		return nil
+	}
+	return fmt.Errorf("terraform upgrade produced changes:\n%s", report)
+}
+
+// stateVersion is the header of a state file.
+type stateVersion struct {
+	Version          int    `json:"version"`
+	TerraformVersion string `json:"terraform_version"`
+}
+
+func readStateVersion(path string) (stateVersion, error) {
+	var v stateVersion
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(content, &v)
+	return v, err
+}
+
+func terraformUpgradeReport(state stateVersion, newVersion string, verdict ChangeVerdict) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Terraform %s -> %s\n", state.TerraformVersion, newVersion))
+	if state.TerraformVersion != newVersion {
+		sb.WriteString(fmt.Sprintf("State format version %d written by %s would be rewritten by %s on the next apply\n", state.Version, state.TerraformVersion, newVersion))
+	} else {
+		sb.WriteString(fmt.Sprintf("State format version %d, no state upgrade\n", state.Version))
+	}
+	if len(verdict.Changes) == 0 {
+		sb.WriteString("No resource changes\n")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("Resource changes:\n%s\n", verdict))
+	return sb.String()
+}
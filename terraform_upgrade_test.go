@@ -0,0 +1,41 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStateVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraform.tfstate")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 4, "terraform_version": "1.5.7", "serial": 3, "resources": []}`), 0600))
+	v, err := readStateVersion(path)
+	require.NoError(t, err)
+	assert.Equal(t, stateVersion{Version: 4, TerraformVersion: "1.5.7"}, v)
+}
+
+func TestTerraformUpgradeReport(t *testing.T) {
+	changes := map[string]*tfjson.ResourceChange{
+		"azurerm_resource_group.this": {
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}},
+		},
+		"azurerm_subnet.this": {
+			Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}},
+		},
+	}
+	verdict, err := ChangePolicy{Allowed: []ChangeKind{ChangeUpdate}}.verdict(changes, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `Terraform 1.5.7 -> 1.9.8
+State format version 4 written by 1.5.7 would be rewritten by 1.9.8 on the next apply
+Resource changes:
+  azurerm_resource_group.this: update (allowed)
+`, terraformUpgradeReport(stateVersion{Version: 4, TerraformVersion: "1.5.7"}, "1.9.8", verdict))
+	assert.Equal(t, `Terraform 1.9.8 -> 1.9.8
+State format version 4, no state upgrade
+No resource changes
+`, terraformUpgradeReport(stateVersion{Version: 4, TerraformVersion: "1.9.8"}, "1.9.8", ChangeVerdict{Passed: true}))
+}
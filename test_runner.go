@@ -66,11 +66,13 @@ func (t *T) Fatalf(format string, args ...interface{}) {
 }
 
 func (t *T) Error(args ...interface{}) {
+	t.failed = true
 	t.error("Error:" + fmt.Sprintln(args...))
 	t.t.Error(args...)
 }
 
 func (t *T) Errorf(format string, args ...interface{}) {
+	t.failed = true
 	t.error("Error:" + fmt.Sprintf(format, args...))
 	t.t.Errorf(format, args...)
 }
@@ -136,10 +138,12 @@ func (m *mockT) Fatalf(format string, args ...interface{}) {
 }
 
 func (m *mockT) Error(args ...interface{}) {
+	m.t.failed = true
 	m.t.error("Error:" + fmt.Sprintln(args...))
 }
 
 func (m *mockT) Errorf(format string, args ...interface{}) {
+	m.t.failed = true
 	m.t.error("Error:" + fmt.Sprintf(format, args...))
 }
 
@@ -11,12 +11,17 @@ var _ testExecutor = unitTestExecutor{}
 
 type unitTestExecutor struct{}
 
-func (u unitTestExecutor) TearDown(t testingT, rootDir string, modulePath string) {}
+func (u unitTestExecutor) TearDown(t testingT, rootDir string, modulePath string, details *testRunDetails) {}
 
 func (u unitTestExecutor) Logger() logger.TestLogger {
 	return logger.Discard
 }
 
 func RunUnitTest(t *testing.T, moduleRootPath, exampleRelativePath string, option terraform.Options, assertion func(*testing.T, TerraformOutput)) {
-	initAndApplyAndIdempotentTest(newT(t), moduleRootPath, exampleRelativePath, option, true, true, assertion, unitTestExecutor{})
+	initAndApplyAndIdempotentTest(newT(t), moduleRootPath, exampleRelativePath, TestOptions{
+		TerraformOptions:    option,
+		Assertion:           assertion,
+		SkipIdempotentCheck: true,
+		SkipDestroy:         true,
+	}, unitTestExecutor{})
 }
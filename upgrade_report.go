@@ -0,0 +1,117 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	terratest "github.com/gruntwork-io/terratest/modules/testing"
+)
+
+const upgradeReportFileName = "UpgradeReport.json"
+
+// UpgradeReport is the verdict of an upgrade test, Hops are the changes the test went through, like `v7.5.0 -> current` for module upgrades,
+// `locked -> upgraded` for provider upgrades, or `1.5.7 -> 1.9.8` for Terraform upgrades.
+// Reports of an example are stored in `TestRecord/<example folder>/UpgradeReport.json` under the current module's root, one report per test.
+type UpgradeReport struct {
+	Test     string       `json:"test"`
+	Kind     string       `json:"kind"`
+	Example  string       `json:"example"`
+	Baseline string       `json:"baseline"`
+	Time     time.Time    `json:"time"`
+	Passed   bool         `json:"passed"`
+	Error    string       `json:"error,omitempty"`
+	Hops     []UpgradeHop `json:"hops"`
+}
+
+type UpgradeHop struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Verdict ChangeVerdict `json:"verdict"`
+}
+
+func newUpgradeReport(t terratest.TestingT, kind, example, baseline string) *UpgradeReport {
+	return &UpgradeReport{
+		Test:     t.Name(),
+		Kind:     kind,
+		Example:  filepath.ToSlash(example),
+		Baseline: baseline,
+		Time:     time.Now().UTC(),
+	}
+}
+
+func (r *UpgradeReport) addHop(from, to string, verdict ChangeVerdict) {
+	r.Hops = append(r.Hops, UpgradeHop{From: from, To: to, Verdict: verdict})
+}
+
+// save writes the report with testErr as its verdict and returns testErr. The report is a side output, it never fails the test:
+// a relative moduleRootPath is resolved against the example, not the process, so the report is skipped with a log, pass an absolute path like GetCurrentModuleRootPath's,
+// and failing to write the report is logged too.
+func (r *UpgradeReport) save(t terratest.TestingT, moduleRootPath string, testErr error) error {
+	if testErr == CannotTestError || testErr == SkipV0Error || testErr == NoBaselineLockFileError {
+		return testErr
+	}
+	if !filepath.IsAbs(moduleRootPath) {
+		logger.Log(t, fmt.Sprintf("===> upgrade report skipped, module root path %s is not absolute, use GetCurrentModuleRootPath", moduleRootPath))
+		return testErr
+	}
+	r.Passed, r.Error = testErr == nil, ""
+	if testErr != nil {
+		r.Error = testErr.Error()
+	}
+	path := filepath.Join(moduleRootPath, "TestRecord", filepath.Base(r.Example), upgradeReportFileName)
+	if err := saveUpgradeReport(path, *r); err != nil {
+		logger.Log(t, fmt.Sprintf("===> cannot write upgrade report %s: %s", path, err.Error()))
+	}
+	return testErr
+}
+
+// processModuleRoot resolves moduleRootPath against the process, it fits tests that copy the example from moduleRootPath themselves,
+// unlike the module upgrade tests' currentModulePath, which the example's module source refers to.
+func processModuleRoot(moduleRootPath string) string {
+	if abs, err := filepath.Abs(moduleRootPath); err == nil {
+		return abs
+	}
+	return moduleRootPath
+}
+
+// saveUpgradeReport replaces the report of the same test in the file, other tests' reports are kept, reports are sorted by test name.
+func saveUpgradeReport(path string, report UpgradeReport) error {
+	unlock, err := recordFileLocks.LockE(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var reports []UpgradeReport
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err = json.Unmarshal(content, &reports); err != nil {
+			return fmt.Errorf("cannot parse upgrade report %s: %s", path, err.Error())
+		}
+	}
+	merged := []UpgradeReport{report}
+	for _, r := range reports {
+		if r.Test != report.Test {
+			merged = append(merged, r)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Test < merged[j].Test
+	})
+	content, err = json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	return writeStringToFile(path, string(content)+"\n")
+}
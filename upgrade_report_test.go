@@ -0,0 +1,65 @@
+package terraform_module_test_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readUpgradeReports(t *testing.T, path string) []UpgradeReport {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var reports []UpgradeReport
+	require.NoError(t, json.Unmarshal(content, &reports))
+	return reports
+}
+
+func TestUpgradeReportSave(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "TestRecord", "startup", upgradeReportFileName)
+	verdict := ChangeVerdict{Changes: []ClassifiedChange{
+		{Address: "azurerm_subnet.this", Kind: ChangeReplace, Actions: []string{"delete", "create"}, ActionReason: "replace_because_cannot_update"},
+	}}
+
+	report := newUpgradeReport(t, "upgrade", "examples/startup", "v7.5.0")
+	report.addHop("v7.5.0", currentCodeHop, verdict)
+	testErr := fmt.Errorf("terraform configuration not idempotent")
+	assert.Equal(t, testErr, report.save(t, root, testErr))
+
+	reports := readUpgradeReports(t, path)
+	require.Len(t, reports, 1)
+	assert.Equal(t, "TestUpgradeReportSave", reports[0].Test)
+	assert.Equal(t, "examples/startup", reports[0].Example)
+	assert.False(t, reports[0].Passed)
+	assert.Equal(t, testErr.Error(), reports[0].Error)
+	assert.Equal(t, []UpgradeHop{{From: "v7.5.0", To: currentCodeHop, Verdict: verdict}}, reports[0].Hops)
+
+	require.NoError(t, saveUpgradeReport(path, UpgradeReport{Test: "TestA", Passed: true}))
+	report.Hops = nil
+	require.NoError(t, report.save(t, root, nil))
+	reports = readUpgradeReports(t, path)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "TestA", reports[0].Test)
+	assert.Equal(t, "TestUpgradeReportSave", reports[1].Test)
+	assert.True(t, reports[1].Passed)
+	assert.Empty(t, reports[1].Error)
+}
+
+func TestUpgradeReportSkipsSkippedTests(t *testing.T) {
+	root := t.TempDir()
+	report := newUpgradeReport(t, "upgrade", "examples/startup", "v0.1.0")
+	assert.Equal(t, SkipV0Error, report.save(t, root, SkipV0Error))
+	assert.NoFileExists(t, filepath.Join(root, "TestRecord", "startup", upgradeReportFileName))
+}
+
+func TestUpgradeReportSkipsRelativeRootWithoutFailingTheTest(t *testing.T) {
+	report := newUpgradeReport(t, "upgrade", "examples/startup", "v7.5.0")
+	assert.NoError(t, report.save(t, "../../after_upgrade", nil))
+	assert.False(t, t.Failed())
+	assert.NoFileExists(t, filepath.Join("../../after_upgrade", "TestRecord", "startup", upgradeReportFileName))
+}
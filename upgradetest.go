@@ -7,13 +7,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ahmetb/go-linq/v3"
-	"github.com/google/go-github/v42/github"
 	"github.com/gruntwork-io/terratest/modules/files"
 	"github.com/gruntwork-io/terratest/modules/logger"
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -21,7 +21,6 @@ import (
 	terratest "github.com/gruntwork-io/terratest/modules/testing"
 	"github.com/hashicorp/go-getter/v2"
 	"github.com/hashicorp/terraform-json"
-	"github.com/lonegunmanb/tfmodredirector"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/mod/semver"
 )
@@ -29,22 +28,98 @@ import (
 var CannotTestError = fmt.Errorf("no previous tag yet or previous tag's folder structure is different than the current version, skip upgrade test")
 var SkipV0Error = fmt.Errorf("v0 is meant to be unstable, skip upgrade test")
 
-type repositoryTag struct {
-	*github.RepositoryTag
+// versionTag is a tag along with its semantic version, like `v1.2.0` for the tag `1.2.0`.
+type versionTag struct {
+	name    string
 	version string
 }
 
 //goland:noinspection GoUnusedExportedFunction
 func ModuleUpgradeTest(t *testing.T, owner, repo, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int) {
+	ModuleUpgradeTestWithSource(t, GitHubSource{Owner: owner, Repo: repo}, moduleFolderRelativeToRoot, currentModulePath, opts, currentMajorVer)
+}
+
+// ModuleUpgradeTestWithSource is ModuleUpgradeTest with the baseline tags and code read from source, like a local clone or a folder of release archives.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModuleUpgradeTestWithSource(t *testing.T, source BaselineSource, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int) {
+	ModuleUpgradeTestWithOptions(t, source, moduleFolderRelativeToRoot, currentModulePath, opts, currentMajorVer, ModuleUpgradeOptions{})
+}
+
+// ModuleUpgradeTestWithPolicy is ModuleUpgradeTestWithSource with the baselines picked by policy, like PreviousMinor or SemverConstraint.
+// A policy that picks several tags, like LatestPatches or Baselines, runs one parallel subtest named by the tag per baseline.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModuleUpgradeTestWithPolicy(t *testing.T, source BaselineSource, policy BaselinePolicy, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int) {
+	ModuleUpgradeTestWithOptions(t, source, moduleFolderRelativeToRoot, currentModulePath, opts, currentMajorVer, ModuleUpgradeOptions{Baseline: policy})
+}
+
+// ModuleUpgradeOptions are the per-test settings of ModuleUpgradeTestWithOptions and ModuleChainedUpgradeTestWithOptions.
+type ModuleUpgradeOptions struct {
+	// Baseline picks the tags to upgrade from, default to the latest tag within the current major version.
+	Baseline BaselinePolicy
+	// Policy is the ChangePolicy the plan is checked against after the module source is re-pointed,
+	// like `ChangePolicy{Allowed: []ChangeKind{ChangeUpdate}}` to accept in-place updates but fail replacements. The zero value fails any change.
+	Policy ChangePolicy
+	// SourceRedirects re-point the example's module blocks to the code under test besides the default `../..` and `../../modules/x`,
+	// like `RegistrySourceRedirect("Azure", "aks", "azurerm")` for examples that reference the module by registry address.
+	SourceRedirects []SourceRedirect
+	// OutputIgnores are regular expressions matched against output names, matched outputs' stability isn't checked, like `^timestamp$`.
+	OutputIgnores []string
+}
+
+// ModuleUpgradeTestWithOptions is ModuleUpgradeTestWithSource with the baselines and the change policy set by upgradeOpts.
+// A v0 module is skipped only when the baselines are picked within the current major version, explicit baselines like ExplicitTag or SemverConstraint are tested.
+//
+//goland:noinspection GoUnusedExportedFunction
+func ModuleUpgradeTestWithOptions(t *testing.T, source BaselineSource, moduleFolderRelativeToRoot, currentModulePath string, opts terraform.Options, currentMajorVer int, upgradeOpts ModuleUpgradeOptions) {
+	tryParallel(newT(t))
+	if upgradeOpts.Baseline == nil {
+		runModuleUpgradeTest(t, source, moduleFolderRelativeToRoot, opts, func(t *T, opts terraform.Options) error {
+			return moduleUpgrade(t, source, moduleFolderRelativeToRoot, currentModulePath, opts, currentMajorVer, upgradeOpts)
+		})
+		return
+	}
+	if currentMajorVer == 0 && selectsByMajorVersion(upgradeOpts.Baseline) {
+		t.Skip(SkipV0Error.Error())
+	}
+	tags, err := selectBaselines(source, upgradeOpts.Baseline, currentMajorVer)
+	if err == CannotTestError {
+		t.Skip(err.Error())
+	}
+	require.NoError(t, err)
+	forEachBaseline(t, tags, func(t *testing.T, tag string) {
+		runModuleUpgradeTest(t, source, moduleFolderRelativeToRoot, opts, func(t *T, opts terraform.Options) error {
+			return moduleUpgradeFromTag(t, source, tag, moduleFolderRelativeToRoot, currentModulePath, opts, upgradeOpts)
+		})
+	})
+}
+
+// forEachBaseline runs test in t for a single tag, or in one parallel subtest named by the tag per tag.
+func forEachBaseline(t *testing.T, tags []string, test func(t *testing.T, tag string)) {
+	if len(tags) == 1 {
+		test(t, tags[0])
+		return
+	}
+	for _, tag := range tags {
+		tag := tag
+		t.Run(tag, func(t *testing.T) {
+			tryParallel(newT(t))
+			test(t, tag)
+		})
+	}
+}
+
+func runModuleUpgradeTest(t *testing.T, source BaselineSource, moduleFolderRelativeToRoot string, opts terraform.Options, upgrade func(*T, terraform.Options) error) {
 	wrappedT := newT(t)
-	tryParallel(wrappedT)
-	logger.Log(wrappedT, fmt.Sprintf("===> Starting test for %s/%s/examples/%s, since we're running tests in parallel, the test log will be buffered and output to stdout after the test was finished.", owner, repo, moduleFolderRelativeToRoot))
+	defer coordinator.start(wrappedT)()
+	logger.Log(wrappedT, fmt.Sprintf("===> Starting test for %s/%s, since we're running tests in parallel, the test log will be buffered and output to stdout after the test was finished.", source, moduleFolderRelativeToRoot))
 	l := NewMemoryLogger()
 	defer func() { _ = l.Close() }()
 	opts.Logger = logger.New(l)
 	opts = setupRetryLogic(opts)
 
-	err := moduleUpgrade(wrappedT, owner, repo, moduleFolderRelativeToRoot, currentModulePath, retryableOptions(t, opts), currentMajorVer)
+	err := upgrade(wrappedT, retryableOptions(t, opts))
 	if err == CannotTestError || err == SkipV0Error {
 		t.Skip(err.Error())
 	}
@@ -95,32 +170,34 @@ func GetCurrentMajorVersionFromEnv() (int, error) {
 }
 
 func wrap(t interface{}) interface{} {
-	tag := t.(*github.RepositoryTag)
-	return repositoryTag{
-		RepositoryTag: tag,
-		version:       sterilize(tag.GetName()),
+	tag := t.(string)
+	return versionTag{
+		name:    tag,
+		version: sterilize(tag),
 	}
 }
 
 func unwrap(t interface{}) interface{} {
-	return t.(repositoryTag).RepositoryTag
+	return t.(versionTag).name
 }
 
-func moduleUpgrade(t *T, owner string, repo string, moduleFolderRelativeToRoot string, newModulePath string, opts terraform.Options, currentMajorVer int) error {
+func moduleUpgrade(t *T, source BaselineSource, moduleFolderRelativeToRoot string, newModulePath string, opts terraform.Options, currentMajorVer int, upgradeOpts ModuleUpgradeOptions) error {
 	if currentMajorVer == 0 {
 		return SkipV0Error
 	}
-	latestTag, err := getLatestTag(owner, repo, currentMajorVer)
+	latestTag, err := getLatestTag(source, currentMajorVer)
 	if err != nil {
 		return err
 	}
-	if semver.Major(latestTag) == "v0" {
-		return SkipV0Error
-	}
-	tmpDirForTag, err := cloneGithubRepo(owner, repo, &latestTag)
+	return moduleUpgradeFromTag(t, source, latestTag, moduleFolderRelativeToRoot, newModulePath, opts, upgradeOpts)
+}
+
+func moduleUpgradeFromTag(t *T, source BaselineSource, tag string, moduleFolderRelativeToRoot string, newModulePath string, opts terraform.Options, upgradeOpts ModuleUpgradeOptions) error {
+	tmpDirForTag, cleanup, err := source.Checkout(tag)
 	if err != nil {
 		return err
 	}
+	defer cleanup()
 
 	fullTerraformModuleFolder := filepath.Join(tmpDirForTag, moduleFolderRelativeToRoot)
 
@@ -130,82 +207,93 @@ func moduleUpgrade(t *T, owner string, repo string, moduleFolderRelativeToRoot s
 	}
 	tmpTestDir := test_structure.CopyTerraformFolderToTemp(t, tmpDirForTag, moduleFolderRelativeToRoot)
 	defer func() {
-		_ = os.RemoveAll(filepath.Clean(tmpTestDir))
+		removeWorkspace(t, tmpTestDir)
 	}()
-	return diffTwoVersions(t, opts, tmpTestDir, newModulePath)
+	report := newUpgradeReport(t, "upgrade", moduleFolderRelativeToRoot, tag)
+	verdict, err := diffTwoVersions(t, opts, source.String(), moduleFolderRelativeToRoot, tmpTestDir, newModulePath, upgradeOpts)
+	report.addHop(tag, currentCodeHop, verdict)
+	return report.save(t, newModulePath, err)
 }
 
-func diffTwoVersions(t *T, opts terraform.Options, originTerraformDir string, newModulePath string) error {
+func diffTwoVersions(t *T, opts terraform.Options, baseline, moduleFolderRelativeToRoot, originTerraformDir string, newModulePath string, upgradeOpts ModuleUpgradeOptions) (ChangeVerdict, error) {
 	opts.TerraformDir = originTerraformDir
-	defer destroy(t, opts)
+	if err := renderTemplates(t, opts); err != nil {
+		return ChangeVerdict{}, err
+	}
+	opts, err := isolateEnv(opts)
+	if err != nil {
+		return ChangeVerdict{}, err
+	}
+	entry := registerWorkspace(t, baseline, moduleFolderRelativeToRoot, opts)
+	defer destroyTracked(t, opts, VerifyStateEmpty, entry)
 	initAndApply(t, &opts)
-	overrideModuleSourceToCurrentPath(t, originTerraformDir, newModulePath)
-	return initAndPlanAndIdempotentAtEasyMode(t, opts)
+	coordinator.failIfInterrupted(t)
+	outputs, err := terraformOutputs(t, opts)
+	if err != nil {
+		return ChangeVerdict{}, err
+	}
+	overrideModuleSourceToCurrentPath(t, originTerraformDir, upgradeOpts.SourceRedirects, newModulePath)
+	verdict, err := initAndPlanAndIdempotentAtEasyMode(t, opts, upgradeOpts.Policy)
+	if err != nil {
+		return verdict, err
+	}
+	return verdict, checkOutputStability(t, opts, outputs, upgradeOpts.OutputIgnores)
 }
 
-var initAndPlanAndIdempotentAtEasyMode = func(t testingT, opts terraform.Options) error {
+// initAndPlanAndIdempotentAtEasyMode plans and checks the changes against policy, the error contains the verdict and the plan when the policy fails.
+var initAndPlanAndIdempotentAtEasyMode = func(t testingT, opts terraform.Options, policy ChangePolicy) (ChangeVerdict, error) {
 	opts.PlanFilePath = filepath.Join(opts.TerraformDir, "tf.plan")
 	opts.Logger = logger.Discard
 	exitCode := initAndPlanWithExitCode(t, &opts)
-	plan := terraform.InitAndPlanAndShowWithStruct(t, &opts)
-	changes := plan.ResourceChangesMap
-	if exitCode == 0 || noChange(changes) {
-		return nil
+	if exitCode == 0 {
+		return ChangeVerdict{Passed: true}, nil
 	}
-	return fmt.Errorf("terraform configuration not idempotent:%s", terraform.Plan(t, &opts))
+	plan, reasons := initAndPlanWithActionReasons(t, opts)
+	verdict, err := policy.verdict(plan.ResourceChangesMap, reasons)
+	if err != nil || verdict.Passed {
+		return verdict, err
+	}
+	return verdict, fmt.Errorf("terraform configuration not idempotent:\n%s\n%s", verdict, terraform.Plan(t, &opts))
 }
 
-func noChange(changes map[string]*tfjson.ResourceChange) bool {
-	if len(changes) == 0 {
-		return true
+func ignoreChanges(changes map[string]*tfjson.ResourceChange, ignores []string) (map[string]*tfjson.ResourceChange, error) {
+	if len(ignores) == 0 {
+		return changes, nil
 	}
-	return linq.From(changes).Select(func(i interface{}) interface{} {
-		return i.(linq.KeyValue).Value
-	}).All(func(i interface{}) bool {
-		change := i.(*tfjson.ResourceChange).Change
-		if change == nil {
-			return true
+	var regexes []*regexp.Regexp
+	for _, ignore := range ignores {
+		r, err := regexp.Compile(ignore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idempotent ignore pattern %s: %s", ignore, err.Error())
 		}
-		if change.Actions == nil {
-			return true
+		regexes = append(regexes, r)
+	}
+	result := make(map[string]*tfjson.ResourceChange)
+	for address, change := range changes {
+		ignored := linq.From(regexes).AnyWith(func(i interface{}) bool {
+			return i.(*regexp.Regexp).MatchString(address)
+		})
+		if !ignored {
+			result[address] = change
 		}
-		return change.Actions.NoOp()
-	})
-}
-
-func overrideModuleSourceToCurrentPath(t *T, moduleDir string, currentModulePath string) {
-	require.NoError(t, rewriteHcl(moduleDir, currentModulePath))
+	}
+	return result, nil
 }
 
-func rewriteHcl(moduleDir, newModuleSource string) error {
-	entries, err := os.ReadDir(moduleDir)
-	if err != nil {
-		return err
+// changeActions returns the change's actions like `delete, create`, or an empty string for a no-op change.
+func changeActions(change *tfjson.ResourceChange) string {
+	if change.Change == nil || change.Change.Actions == nil || change.Change.Actions.NoOp() {
+		return ""
 	}
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tf") {
-			continue
-		}
-		filePath := filepath.Clean(filepath.Join(moduleDir, entry.Name()))
-		f, err := os.ReadFile(filePath)
-		if err != nil {
-			return err
-		}
-		tfCode := string(f)
-		tfCode, err = tfmodredirector.RedirectModuleSource(tfCode, "../../", newModuleSource)
-		if err != nil {
-			return err
-		}
-		tfCode, err = tfmodredirector.RedirectModuleSource(tfCode, "../..", newModuleSource)
-		if err != nil {
-			return err
-		}
-		err = os.WriteFile(filePath, []byte(tfCode), 0600)
-		if err != nil {
-			return err
-		}
+	var actions []string
+	for _, action := range change.Change.Actions {
+		actions = append(actions, string(action))
 	}
-	return nil
+	return strings.Join(actions, ", ")
+}
+
+func overrideModuleSourceToCurrentPath(t *T, moduleDir string, redirects []SourceRedirect, currentModulePath string) {
+	require.NoError(t, rewriteHcl(moduleDir, redirects, currentModulePath))
 }
 
 var cloneGithubRepo = func(owner string, repo string, tag *string) (string, error) {
@@ -223,21 +311,12 @@ var cloneGithubRepo = func(owner string, repo string, tag *string) (string, erro
 	return tmpDir, nil
 }
 
-var getLatestTag = func(owner string, repo string, currentMajorVer int) (string, error) {
-	client := github.NewClient(githubClient())
-	tags, _, err := client.Repositories.ListTags(context.TODO(), owner, repo, nil)
+var getLatestTag = func(source BaselineSource, currentMajorVer int) (string, error) {
+	tags, err := selectBaselines(source, LatestWithinMajor{}, currentMajorVer)
 	if err != nil {
 		return "", err
 	}
-	if tags == nil {
-		return "", fmt.Errorf("cannot find tags")
-	}
-	first := latestTagWithinMajorVersion(tags, currentMajorVer)
-	if first == nil {
-		return "", CannotTestError
-	}
-	latestTag := first.GetName()
-	return latestTag, nil
+	return tags[0], nil
 }
 
 func githubClient() *http.Client {
@@ -253,30 +332,27 @@ func githubClient() *http.Client {
 	return httpClient
 }
 
-func latestTagWithinMajorVersion(tags []*github.RepositoryTag, currentMajorVer int) *github.RepositoryTag {
-	t := linq.From(tags).Where(notNil).Select(wrap).Where(valid).Sort(bySemantic).Where(sameMajorVersion(currentMajorVer)).Select(unwrap).First()
+// latestTagWithinMajorVersion returns the newest release tag within the major version, tags containing "rc" are skipped. It's empty when no tag fits.
+func latestTagWithinMajorVersion(tags []string, currentMajorVer int) string {
+	t := linq.From(tags).Select(wrap).Where(valid).Sort(bySemantic).Where(sameMajorVersion(currentMajorVer)).Select(unwrap).First()
 	if t == nil {
-		return nil
+		return ""
 	}
-	return t.(*github.RepositoryTag)
-}
-
-func notNil(i interface{}) bool {
-	return i != nil
+	return t.(string)
 }
 
 func valid(t interface{}) bool {
 	if t == nil {
 		return false
 	}
-	tag := t.(repositoryTag)
+	tag := t.(versionTag)
 	v := tag.version
 	return semver.IsValid(v) && !strings.Contains(v, "rc")
 }
 
 func bySemantic(i, j interface{}) bool {
-	it := i.(repositoryTag)
-	jt := j.(repositoryTag)
+	it := i.(versionTag)
+	jt := j.(versionTag)
 	return semver.Compare(it.version, jt.version) > 0
 }
 
@@ -289,7 +365,7 @@ func sterilize(v string) string {
 
 func sameMajorVersion(majorVersion int) func(i interface{}) bool {
 	return func(i interface{}) bool {
-		major := semver.Major(i.(repositoryTag).version)
+		major := semver.Major(i.(versionTag).version)
 		currentMajor := fmt.Sprintf("v%d", majorVersion)
 		return major == currentMajor
 	}
@@ -5,7 +5,6 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/google/go-github/v42/github"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/prashantv/gostub"
@@ -14,14 +13,14 @@ import (
 )
 
 func TestModuleUpgradeTest(t *testing.T) {
-	stub := gostub.Stub(&getLatestTag, func(owner string, repo string, currentMajorVer int) (string, error) {
+	stub := gostub.Stub(&getLatestTag, func(source BaselineSource, currentMajorVer int) (string, error) {
 		return "v1.0.0", nil
 	})
 	defer stub.Reset()
 	stub.Stub(&cloneGithubRepo, func(owner string, repo string, tag *string) (string, error) {
 		return "./", nil
 	})
-	err := moduleUpgrade(newT(t), "lonegunmanb", "terraform-module-test-helper", "example/upgrade/example/version_upgrade", "../../../after_upgrade", terraform.Options{Upgrade: true}, 1)
+	err := moduleUpgrade(newT(t), GitHubSource{Owner: "lonegunmanb", Repo: "terraform-module-test-helper"}, "example/upgrade/example/version_upgrade", "../../../after_upgrade", terraform.Options{Upgrade: true}, 1, ModuleUpgradeOptions{})
 	if err == nil {
 		assert.FailNow(t, "expect test failure, but test success")
 	}
@@ -31,19 +30,19 @@ func TestModuleUpgradeTest(t *testing.T) {
 }
 
 func TestModuleUpgradeTestShouldSkipV0(t *testing.T) {
-	stub := gostub.Stub(&getLatestTag, func(owner string, repo string, currentMajorVer int) (string, error) {
+	stub := gostub.Stub(&getLatestTag, func(source BaselineSource, currentMajorVer int) (string, error) {
 		return "v0.0.1", nil
 	})
 	defer stub.Reset()
 	stub.Stub(&cloneGithubRepo, func(owner string, repo string, tag *string) (string, error) {
 		return "./", nil
 	})
-	err := moduleUpgrade(newT(t), "lonegunmanb", "terraform-module-test-helper", "example/upgrade", "./", terraform.Options{Upgrade: true}, 0)
+	err := moduleUpgrade(newT(t), GitHubSource{Owner: "lonegunmanb", Repo: "terraform-module-test-helper"}, "example/upgrade", "./", terraform.Options{Upgrade: true}, 0, ModuleUpgradeOptions{})
 	assert.Equal(t, SkipV0Error, err)
 }
 
 func TestGetLatestTag(t *testing.T) {
-	tag, err := getLatestTag("hashicorp", "terraform", 1)
+	tag, err := getLatestTag(GitHubSource{Owner: "hashicorp", Repo: "terraform"}, 1)
 	assert.Nil(t, err)
 	assert.True(t, semver.IsValid(tag))
 	assert.Equal(t, "v1", semver.Major(tag))
@@ -52,7 +51,7 @@ func TestGetLatestTag(t *testing.T) {
 func TestSkipIfNoTagsWithinMajorVersion(t *testing.T) {
 	v := os.TempDir()
 	assert.NotEqual(t, "", v)
-	_, err := getLatestTag("hashicorp", "terraform", 100)
+	_, err := getLatestTag(GitHubSource{Owner: "hashicorp", Repo: "terraform"}, 100)
 	assert.Equal(t, CannotTestError, err)
 }
 
@@ -75,76 +74,46 @@ func TestGetCurrentMajorVersionFromEnv_basic(t *testing.T) {
 }
 
 func TestTagWithAlphaSuffix(t *testing.T) {
-	alpha := "v0.1.0-alpha"
-	current := "0.1.1"
-	alphaTag := &github.RepositoryTag{
-		Name: &alpha,
-	}
-	currentTag := &github.RepositoryTag{
-		Name: &current,
-	}
-	sort := bySemantic(wrap(alphaTag), wrap(currentTag))
+	sort := bySemantic(wrap("v0.1.0-alpha"), wrap("0.1.1"))
 	assert.False(t, sort)
 }
 
 func TestLatestTagWithAlphaSuffix(t *testing.T) {
-	alphaVersion := "v0.1.0-alpha"
 	latestVersion := "0.1.2"
-	tags := []*github.RepositoryTag{
-		{
-			Name: &alphaVersion,
-		},
-		{
-			Name: &latestVersion,
-		},
-	}
+	tags := []string{"v0.1.0-alpha", latestVersion}
 	first := latestTagWithinMajorVersion(tags, 0)
-	assert.Equal(t, latestVersion, first.GetName())
+	assert.Equal(t, latestVersion, first)
 }
 
 func TestLatestTag(t *testing.T) {
-	alphaVersion := "0.1.0"
 	latestVersion := "0.1.2"
-	tags := []*github.RepositoryTag{
-		{
-			Name: &alphaVersion,
-		},
-		{
-			Name: &latestVersion,
-		},
-	}
+	tags := []string{"0.1.0", latestVersion}
 	first := latestTagWithinMajorVersion(tags, 0)
-	assert.Equal(t, latestVersion, first.GetName())
+	assert.Equal(t, latestVersion, first)
 }
 
 func TestNoValidVersion(t *testing.T) {
-	v1 := "a.b.c"
-	v2 := "e.f.g"
-	tags := []*github.RepositoryTag{
-		{
-			Name: &v1,
-		},
-		{
-			Name: &v2,
-		},
-	}
-	first := latestTagWithinMajorVersion(tags, 0)
-	assert.Nil(t, first)
+	first := latestTagWithinMajorVersion([]string{"a.b.c", "e.f.g"}, 0)
+	assert.Empty(t, first)
 }
 
 func TestAddNewOutputShouldNotFailTheTest(t *testing.T) {
 	tmpDir := test_structure.CopyTerraformFolderToTemp(t, "./example/output_upgrade", "test")
-	err := diffTwoVersions(newT(t), terraform.Options{
+	_, err := diffTwoVersions(newT(t), terraform.Options{
 		Upgrade: true,
-	}, tmpDir, "../after")
+	}, "./", "example/output_upgrade", tmpDir, "../after", ModuleUpgradeOptions{
+		SourceRedirects: []SourceRedirect{{Pattern: `^\.\./before/?$`}},
+	})
 	assert.Nil(t, err)
 }
 
 func TestNoChange(t *testing.T) {
 	tmpDir := test_structure.CopyTerraformFolderToTemp(t, "./example/output_upgrade", "test")
-	err := diffTwoVersions(newT(t), terraform.Options{
+	_, err := diffTwoVersions(newT(t), terraform.Options{
 		Upgrade: true,
-	}, tmpDir, "../before")
+	}, "./", "example/output_upgrade", tmpDir, "../before", ModuleUpgradeOptions{
+		SourceRedirects: []SourceRedirect{{Pattern: `^\.\./before/?$`}},
+	})
 	assert.Nil(t, err)
 }
 
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,15 +22,81 @@ var recordFileLocks = &KeyedMutex{}
 
 const NoErrorMessage = "No error was found."
 
+const (
+	lockDirEnv              = "TEST_LOCK_DIR"
+	defaultKeyedLockTimeout = 30 * time.Minute
+)
+
+// KeyedMutex locks by key across processes, so test packages sharing the same module root won't collide.
+// Goroutines in the same process wait on an in-process mutex first, then the holder takes an OS lock (`flock` on Unix, `LockFileEx` on Windows) on a file named by the key's hash under Dir.
+// The OS releases the lock when its owner dies, so a crashed test never leaves a stale lock behind.
 type KeyedMutex struct {
 	mutexes sync.Map // Zero value is empty and ready for use
+	// Dir is the folder of lock files, default to `TEST_LOCK_DIR`, or `terraform-module-test-helper/locks` in the system temp folder.
+	Dir string
+	// Timeout is how long LockE waits for the lock file, default to 30 minutes. Lock ignores it.
+	Timeout time.Duration
 }
 
+// Lock waits for the lock without timeout. When the file lock cannot be taken, like an unwritable Dir, it reports the error on stderr and only locks within the process,
+// use LockE to get the error and to give up after Timeout.
 func (m *KeyedMutex) Lock(key string) func() {
-	value, _ := m.mutexes.LoadOrStore(key, &sync.Mutex{})
-	mtx := value.(*sync.Mutex)
+	mtx := m.mutex(key)
 	mtx.Lock()
-	return func() { mtx.Unlock() }
+	unlock, err := m.fileLock(key, 0).Lock()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "cannot lock %s across processes, only locking within this process: %s\n", key, err.Error())
+		return mtx.Unlock
+	}
+	return func() {
+		unlock()
+		mtx.Unlock()
+	}
+}
+
+// LockE returns an error when the lock cannot be acquired before Timeout.
+func (m *KeyedMutex) LockE(key string) (func(), error) {
+	mtx := m.mutex(key)
+	mtx.Lock()
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = defaultKeyedLockTimeout
+	}
+	unlock, err := m.fileLock(key, timeout).Lock()
+	if err != nil {
+		mtx.Unlock()
+		return nil, fmt.Errorf("cannot lock %s: %w", key, err)
+	}
+	return func() {
+		unlock()
+		mtx.Unlock()
+	}, nil
+}
+
+func (m *KeyedMutex) mutex(key string) *sync.Mutex {
+	value, _ := m.mutexes.LoadOrStore(key, &sync.Mutex{})
+	return value.(*sync.Mutex)
+}
+
+func (m *KeyedMutex) fileLock(key string, timeout time.Duration) *fileLock {
+	l := newFileLock(filepath.Join(m.dir(), hash(key)+".lock"))
+	l.timeout = timeout
+	return l
+}
+
+func (m *KeyedMutex) dir() string {
+	return lockDir(m.Dir)
+}
+
+// lockDir returns dir if set, or `TEST_LOCK_DIR`, or `terraform-module-test-helper/locks` in the system temp folder.
+func lockDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if dir := os.Getenv(lockDirEnv); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "terraform-module-test-helper", "locks")
 }
 
 type TestVersionSnapshot struct {
@@ -39,6 +106,10 @@ type TestVersionSnapshot struct {
 	Success                 bool
 	Versions                string
 	ErrorMsg                string
+	KeptWorkspace           string
+	CutPhases               []string
+	CapacityWait            time.Duration
+	TerraformBinary         string
 }
 
 func SuccessTestVersionSnapshot(rootFolder, exampleRelativePath string) *TestVersionSnapshot {
@@ -76,25 +147,57 @@ Success: %t
 ### Error
 
 %s
-
+%s
 ---
 
-`, s.Time.Format(time.RFC822), s.Success, s.Versions, errorMsg)
+`, s.Time.Format(time.RFC822), s.Success, s.Versions, errorMsg, s.details())
+}
+
+func (s *TestVersionSnapshot) details() string {
+	sb := strings.Builder{}
+	if s.TerraformBinary != "" {
+		sb.WriteString(fmt.Sprintf("\n### Terraform Binary\n\n%s\n", s.TerraformBinary))
+	}
+	if s.KeptWorkspace != "" {
+		sb.WriteString(fmt.Sprintf("\n### Kept Workspace\n\n%s\n", s.KeptWorkspace))
+	}
+	if len(s.CutPhases) > 0 {
+		sb.WriteString(fmt.Sprintf("\n### Phases Cut By Deadline\n\n%s\n", strings.Join(s.CutPhases, "\n")))
+	}
+	if s.CapacityWait > 0 {
+		sb.WriteString(fmt.Sprintf("\n### Waited For Capacity\n\n%s\n", s.CapacityWait.Round(time.Second)))
+	}
+	return sb.String()
 }
 
 func (s *TestVersionSnapshot) Save(t terratest.TestingT) error {
-	path, err := filepath.Abs(filepath.Clean(filepath.Join(s.ModuleRootFolder, s.SubModuleRelativeFolder, "TestRecord.md.tmp")))
+	return saveSnapshots(t, []*TestVersionSnapshot{s})
+}
+
+// saveSnapshots saves snapshots of the same example into one TestRecord, eg: results of a binary matrix.
+func saveSnapshots(t terratest.TestingT, snapshots []*TestVersionSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	first := snapshots[0]
+	path, err := filepath.Abs(filepath.Clean(filepath.Join(first.ModuleRootFolder, first.SubModuleRelativeFolder, "TestRecord.md.tmp")))
 	if err != nil {
 		return err
 	}
-	unlock := recordFileLocks.Lock(path)
-	defer unlock()
-	s.load(t)
-	err = s.saveToLocal(path)
+	sb := strings.Builder{}
+	for _, s := range snapshots {
+		s.load(t)
+		sb.WriteString(s.ToString())
+	}
+	unlock, err := recordFileLocks.LockE(path)
 	if err != nil {
 		return err
 	}
-	return s.copyForUploadArtifact(path)
+	defer unlock()
+	if err = writeStringToFile(path, sb.String()); err != nil {
+		return err
+	}
+	return first.copyForUploadArtifact(path)
 }
 
 func (s *TestVersionSnapshot) copyForUploadArtifact(localPath string) error {
@@ -103,10 +206,6 @@ func (s *TestVersionSnapshot) copyForUploadArtifact(localPath string) error {
 	return copyFile(localPath, pathForUpload)
 }
 
-func (s *TestVersionSnapshot) saveToLocal(path string) error {
-	return writeStringToFile(path, s.ToString())
-}
-
 func copyFile(src, dst string) error {
 	cleanedSrc := filepath.Clean(src)
 	cleanedDst := filepath.Clean(dst)
@@ -161,15 +260,12 @@ func (s *TestVersionSnapshot) load(t terratest.TestingT) {
 		_ = os.RemoveAll(tmpDir)
 	}()
 	opts := terraform.Options{
-		TerraformDir: tmpDir,
-		NoColor:      true,
-		Logger:       logger.Discard,
-	}
-	if output, err := func() (string, error) {
-		initLock.Lock()
-		defer initLock.Unlock()
-		return initE(t, &opts)
-	}(); err != nil {
+		TerraformBinary: s.TerraformBinary,
+		TerraformDir:    tmpDir,
+		NoColor:         true,
+		Logger:          logger.Discard,
+	}
+	if output, err := initWithPluginCache(t, &opts, initE); err != nil {
 		s.Success = false
 		s.ErrorMsg = output
 		return
@@ -100,3 +100,59 @@ func TestVersionSnapshotRecord_versionCommandErrorShouldReturnVersionCommandErro
 	s.load(t)
 	assert.Equal(t, expectedOutput, s.ErrorMsg)
 }
+
+func TestKeyedMutex_lockAcrossInstancesSharingDir(t *testing.T) {
+	dir := t.TempDir()
+	m1 := &KeyedMutex{Dir: dir}
+	m2 := &KeyedMutex{Dir: dir, Timeout: 200 * time.Millisecond}
+	unlock := m1.Lock("example/basic")
+	_, err := m2.LockE("example/basic")
+	require.Error(t, err)
+	otherKey, err := m2.LockE("example/other")
+	require.NoError(t, err)
+	otherKey()
+	unlock()
+	unlock2, err := m2.LockE("example/basic")
+	require.NoError(t, err)
+	unlock2()
+}
+
+func TestKeyedMutex_lockWaitsWithoutTimeout(t *testing.T) {
+	dir := t.TempDir()
+	m1 := &KeyedMutex{Dir: dir}
+	m2 := &KeyedMutex{Dir: dir, Timeout: 50 * time.Millisecond}
+	unlock := m1.Lock("key")
+	locked := make(chan struct{})
+	go func() {
+		m2.Lock("key")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("lock should wait for the holder")
+	case <-time.After(300 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+}
+
+func TestKeyedMutex_lockFallsBackToProcessLockWhenDirIsUnusable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	m := &KeyedMutex{Dir: filepath.Join(file, "locks")}
+	_, err := m.LockE("key")
+	require.Error(t, err)
+	m.Lock("key")()
+}
+
+func TestKeyedMutex_lockDirFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(lockDirEnv, dir)
+	m := &KeyedMutex{}
+	unlock := m.Lock("key")
+	assert.True(t, files.FileExists(filepath.Join(dir, hash("key")+".lock")))
+	unlock()
+	unlock, err := (&KeyedMutex{Dir: dir, Timeout: time.Second}).LockE("key")
+	require.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,129 @@
+package terraform_module_test_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+type KeepWorkspace int
+
+const (
+	// KeepWorkspaceFromEnv reads the mode from `KEEP_TEST_WORKSPACE` environment variable, `always` or `on_failure`, the workspace is not kept if it's empty.
+	KeepWorkspaceFromEnv KeepWorkspace = iota
+	KeepWorkspaceNever
+	KeepWorkspaceOnFailure
+	KeepWorkspaceAlways
+)
+
+const keepWorkspaceEnv = "KEEP_TEST_WORKSPACE"
+
+// keptWorkspaceDirEnv overrides the folder kept workspaces are moved into, default to `terraform-module-test-helper/workspaces` in os.TempDir().
+const keptWorkspaceDirEnv = "KEEP_TEST_WORKSPACE_DIR"
+
+func (k KeepWorkspace) resolve() KeepWorkspace {
+	if k != KeepWorkspaceFromEnv {
+		return k
+	}
+	switch strings.ToLower(os.Getenv(keepWorkspaceEnv)) {
+	case "always":
+		return KeepWorkspaceAlways
+	case "on_failure":
+		return KeepWorkspaceOnFailure
+	default:
+		return KeepWorkspaceNever
+	}
+}
+
+func (k KeepWorkspace) keep(t testingT) bool {
+	switch k.resolve() {
+	case KeepWorkspaceAlways:
+		return true
+	case KeepWorkspaceOnFailure:
+		// assertions get the raw *testing.T, their failures don't reach the wrapper
+		return t.Failed() || t.T().Failed()
+	default:
+		return false
+	}
+}
+
+// workspaceRoot returns the folder that CopyTerraformFolderToTemp copied the module root into.
+func workspaceRoot(tmpDir, exampleRelativePath string) string {
+	root := filepath.Clean(tmpDir)
+	for _, segment := range strings.Split(filepath.ToSlash(filepath.Clean(exampleRelativePath)), "/") {
+		if segment != "." && segment != "" {
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// keepWorkspace moves the copied module root into a stable folder and returns the example's path in it.
+func keepWorkspace(t testingT, tmpDir, exampleRelativePath string, option terraform.Options) (string, error) {
+	base := os.Getenv(keptWorkspaceDirEnv)
+	if base == "" {
+		base = filepath.Join(os.TempDir(), "terraform-module-test-helper", "workspaces")
+	}
+	src := workspaceRoot(tmpDir, exampleRelativePath)
+	dest := filepath.Join(base, fmt.Sprintf("%s-%s", sanitizeName(t.Name()), time.Now().Format("20060102150405")), filepath.Base(src))
+	if err := os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dest); err != nil {
+		// Rename cannot move folders across devices
+		if err = os.MkdirAll(dest, 0750); err != nil {
+			return "", err
+		}
+		if err = files.CopyFolderContents(src, dest); err != nil {
+			return "", err
+		}
+		_ = os.RemoveAll(src)
+	}
+	kept := filepath.Join(dest, exampleRelativePath)
+	option = relocateIsolatedEnv(option, tmpDir, kept)
+	logger.Log(t, fmt.Sprintf("===> Workspace kept at %s, run the following command to destroy it:\n%s", kept, destroyCommand(kept, option)))
+	return kept, nil
+}
+
+func destroyCommand(dir string, option terraform.Options) string {
+	binary := option.TerraformBinary
+	if binary == "" {
+		binary = "terraform"
+	}
+	args := terraform.FormatArgs(&option, "destroy", "-auto-approve", "-input=false")
+	command := fmt.Sprintf("%s -chdir=%s %s", binary, dir, strings.Join(quoteArgs(args), " "))
+	var envs []string
+	for _, name := range []string{tfDataDirEnv, tfCliConfigFileEnv} {
+		if v, ok := option.EnvVars[name]; ok {
+			envs = append(envs, fmt.Sprintf("%s=%s", name, quoteArgs([]string{v})[0]))
+		}
+	}
+	if len(envs) == 0 {
+		return command
+	}
+	return fmt.Sprintf("%s %s", strings.Join(envs, " "), command)
+}
+
+func quoteArgs(args []string) []string {
+	var r []string
+	for _, arg := range args {
+		if strings.ContainsAny(arg, " \"'$`\\{}[]*") {
+			arg = fmt.Sprintf("'%s'", strings.ReplaceAll(arg, "'", `'"'"'`))
+		}
+		r = append(r, arg)
+	}
+	return r
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func sanitizeName(name string) string {
+	return unsafeNameChars.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,114 @@
+package terraform_module_test_helper
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepWorkspace_resolveFromEnv(t *testing.T) {
+	cases := map[string]KeepWorkspace{
+		"":           KeepWorkspaceNever,
+		"always":     KeepWorkspaceAlways,
+		"on_failure": KeepWorkspaceOnFailure,
+		"ON_FAILURE": KeepWorkspaceOnFailure,
+		"unknown":    KeepWorkspaceNever,
+	}
+	for env, expected := range cases {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(keepWorkspaceEnv, env)
+			assert.Equal(t, expected, KeepWorkspaceFromEnv.resolve())
+		})
+	}
+}
+
+func TestKeepWorkspace_optionOverridesEnv(t *testing.T) {
+	t.Setenv(keepWorkspaceEnv, "always")
+	assert.Equal(t, KeepWorkspaceNever, KeepWorkspaceNever.resolve())
+}
+
+func TestKeepWorkspace_keepOnFailure(t *testing.T) {
+	m := &mockT{t: newT(t)}
+	assert.False(t, KeepWorkspaceOnFailure.keep(m))
+	assert.True(t, KeepWorkspaceAlways.keep(m))
+	m.Errorf("failed")
+	assert.True(t, KeepWorkspaceOnFailure.keep(m))
+	assert.False(t, KeepWorkspaceNever.keep(m))
+}
+
+func TestKeepWorkspace_keepWhenAssertionFailed(t *testing.T) {
+	// the failing assertion runs in a child test process, so its expected failure doesn't fail this test
+	if os.Getenv("KEEP_WORKSPACE_TEST_CHILD") != "" {
+		wrapped := newT(t)
+		if KeepWorkspaceOnFailure.keep(wrapped) {
+			t.Log("kept before failure")
+		}
+		assertion := func(t *testing.T, output TerraformOutput) {
+			assert.Equal(t, "expected", output["id"])
+		}
+		assertion(wrapped.T(), TerraformOutput{"id": "actual"})
+		if KeepWorkspaceOnFailure.keep(wrapped) {
+			t.Log("kept after failure")
+		}
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestKeepWorkspace_keepWhenAssertionFailed$", "-test.v")
+	cmd.Env = append(os.Environ(), "KEEP_WORKSPACE_TEST_CHILD=1")
+	output, err := cmd.CombinedOutput()
+	require.Error(t, err, "the assertion should fail the child test")
+	assert.NotContains(t, string(output), "kept before failure")
+	assert.Contains(t, string(output), "kept after failure")
+}
+
+func TestWorkspaceRoot(t *testing.T) {
+	tmpRoot := filepath.Join(os.TempDir(), "TestX123", "module")
+	assert.Equal(t, tmpRoot, workspaceRoot(filepath.Join(tmpRoot, "examples", "startup"), "examples/startup"))
+	assert.Equal(t, tmpRoot, workspaceRoot(filepath.Join(tmpRoot, "examples", "startup"), "./examples/startup/"))
+}
+
+func TestKeepWorkspace_moveToStableFolder(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv(keptWorkspaceDirEnv, base)
+	tmpRoot := filepath.Join(t.TempDir(), "module")
+	example := filepath.Join(tmpRoot, "examples", "startup")
+	require.NoError(t, os.MkdirAll(filepath.Join(example, ".terraform"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(example, "terraform.tfstate"), []byte("{}"), 0600))
+	kept, err := keepWorkspace(newT(t), example, "examples/startup", terraform.Options{})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(kept, base))
+	assert.True(t, files.FileExists(filepath.Join(kept, "terraform.tfstate")))
+	assert.True(t, files.IsExistingDir(filepath.Join(kept, ".terraform")))
+	assert.False(t, files.FileExists(tmpRoot))
+}
+
+func TestDestroyCommand(t *testing.T) {
+	cmd := destroyCommand("/tmp/workspace", terraform.Options{
+		Vars: map[string]interface{}{
+			"tags": map[string]interface{}{
+				"env": "dev",
+			},
+		},
+		VarFiles: []string{"test.tfvars"},
+	})
+	assert.True(t, strings.HasPrefix(cmd, "terraform -chdir=/tmp/workspace destroy -auto-approve -input=false"))
+	assert.Contains(t, cmd, "-var-file test.tfvars")
+	assert.Contains(t, cmd, `'tags={"env" = "dev"}'`)
+}
+
+func TestVersionSnapshotToString_keptWorkspace(t *testing.T) {
+	snapshot := TestVersionSnapshot{
+		Time:          time.Now(),
+		Success:       false,
+		ErrorMsg:      "error",
+		KeptWorkspace: "/tmp/workspace",
+	}
+	assert.Contains(t, snapshot.ToString(), "### Kept Workspace\n\n/tmp/workspace\n")
+}